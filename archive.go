@@ -0,0 +1,71 @@
+package autogold
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+// archiveExtension is the file extension of golden archives.
+const archiveExtension = ".golden.txtar"
+
+// ExpectArchive checks if files are equal to the sections of the saved
+// `testdata/<test name>.golden.txtar` archive. If they are not, the test is failed and each added,
+// removed or changed file is reported with its own diff.
+//
+// This is useful for tests that produce several related outputs (e.g. generated code, a manifest
+// and logs), which can then be stored and reviewed in a single golden file. The files are stored
+// in the txtar format (see golang.org/x/tools/txtar), which is only suitable for text: a trailing
+// newline is added to files that lack one, and lines of the form `-- name --` are not allowed.
+//
+// If the `go test -update` flag is specified, the archive will be rewritten automatically and the
+// test will not fail unless `-fail-on-update` is specified.
+func ExpectArchive(t *testing.T, files map[string][]byte, opts ...Option) {
+	golden := openGoldenFile(t, opts, goldenPath(t, opts, archiveExtension))
+	defer golden.close()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	archive := &txtar.Archive{}
+	for _, name := range names {
+		file := txtar.File{Name: name, Data: files[name]}
+		if !isValidTxtarFile(file) {
+			t.Fatalf("autogold: file %q could not be stored in a txtar archive, does it contain '-- name --' lines?", name)
+		}
+		archive.Files = append(archive.Files, file)
+	}
+	gotData := txtar.Format(archive)
+
+	// Compare the files as read back from the archive, so that any normalization performed by the
+	// txtar format (e.g. adding trailing newlines) does not produce a mismatch.
+	got := archiveFiles(txtar.Parse(gotData))
+	want := map[string]string{}
+	if wantData := golden.read(); wantData != nil {
+		want = archiveFiles(txtar.Parse(wantData))
+	}
+
+	changes := compareFiles(want, got, opts)
+	if len(changes) == 0 {
+		return
+	}
+	if update() {
+		golden.write(gotData)
+	}
+	if *failOnUpdate || !update() {
+		t.Log(fmt.Errorf("archive mismatch (-want +got):\n%s", colorDiff(changes.String())))
+		t.FailNow()
+	}
+}
+
+func archiveFiles(archive *txtar.Archive) map[string]string {
+	files := make(map[string]string, len(archive.Files))
+	for _, f := range archive.Files {
+		files[f.Name] = string(f.Data)
+	}
+	return files
+}
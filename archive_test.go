@@ -0,0 +1,13 @@
+package autogold
+
+import (
+	"testing"
+)
+
+func TestExpectArchive(t *testing.T) {
+	ExpectArchive(t, map[string][]byte{
+		"gen/types.go":  []byte("package gen\n\ntype Foo struct{}\n"),
+		"manifest.json": []byte(`{"files": ["gen/types.go"]}`),
+		"build.log":     []byte("generated 1 file\n"),
+	})
+}
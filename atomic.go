@@ -0,0 +1,13 @@
+package autogold
+
+import (
+	"os"
+
+	"github.com/hexops/autogold/v2/internal/atomicfile"
+)
+
+// writeFileAtomic writes data to the named file such that an interrupted write (e.g. a killed test
+// process) never leaves it truncated, see atomicfile.WriteFile.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	return atomicfile.WriteFile(name, data, perm)
+}
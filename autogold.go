@@ -2,33 +2,35 @@ package autogold
 
 import (
 	"crypto/sha256"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/hexops/autogold/v2/internal/naming"
 	"github.com/nightlyone/lockfile"
 )
 
 var (
-	clean        = flag.Bool("clean", false, "remove unused .golden files (slightly slower)")
+	clean        = flag.Bool("clean", false, "remove unused golden files once all tests pass (requires autogold.Run in TestMain)")
 	failOnUpdate = flag.Bool("fail-on-update", false, "If a .golden file is updated, fail the test")
-
-	cleanMu  sync.Mutex
-	cleaned  = map[string]struct{}{}
-	cleanDir string
+	reportUnused = flag.Bool("report-unused", false, "list golden files not used by any test, without removing them (requires autogold.Run in TestMain)")
+	failOnUnused = flag.Bool("fail-on-unused", false, "like -report-unused, but fail if there are unused golden files (requires autogold.Run in TestMain)")
 )
 
 func init() {
 	// For compatibility with other packages that also define an -update parameter, only define the
 	// flag if it's not already defined.
 	if updateFlag := flag.Lookup("update"); updateFlag == nil {
-		flag.Bool("update", false, "update .golden files, leaving unused)")
+		flag.Var(new(updateMode), "update", "update .golden files, leaving unused; or with -update=pending, write proposed changes for review with the autogold command")
 	}
 
 	color.NoColor = false
@@ -38,118 +40,107 @@ func update() bool {
 	return flag.Lookup("update").Value.(flag.Getter).Get().(bool)
 }
 
+// pendingUpdate reports whether `-update=pending` is specified, in which case proposed golden files
+// are written next to the golden files (see pending.Path) and proposed changes to autogold.Expect
+// calls are written as patch files (see pending.PatchPath), rather than modifying either.
+func pendingUpdate() bool {
+	mode, ok := flag.Lookup("update").Value.(*updateMode)
+	return ok && *mode == updatePending
+}
+
+// updateMode is the value of the -update flag, which is a boolean flag that also accepts the value
+// "pending".
+type updateMode int
+
+const (
+	updateOff updateMode = iota
+	updateOn
+	updatePending
+)
+
+// String implements flag.Value.
+func (m *updateMode) String() string {
+	switch *m {
+	case updateOn:
+		return "true"
+	case updatePending:
+		return "pending"
+	}
+	return "false"
+}
+
+// Set implements flag.Value.
+func (m *updateMode) Set(s string) error {
+	if s == "pending" {
+		*m = updatePending
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf(`must be a boolean or "pending"`)
+	}
+	*m = updateOff
+	if v {
+		*m = updateOn
+	}
+	return nil
+}
+
+// Get implements flag.Getter. Pending updates are updates, so it reports true for them too.
+func (m *updateMode) Get() interface{} { return *m != updateOff }
+
+// IsBoolFlag allows the flag to be specified as just `-update`.
+func (m *updateMode) IsBoolFlag() bool { return true }
+
 // ExpectFile checks if got is equal to the saved `testdata/<test name>.golden` test file. If it is
 // not, the test is failed.
 //
 // If the `go test -update` flag is specified, the .golden files will be updated/created
-// automatically and the test will not fail unless `-fail-on-update` is specified.
+// automatically and the test will not fail unless `-fail-on-update` is specified. With
+// `-update=pending`, proposed golden files are written to `testdata/<test name>.golden.new` instead,
+// for review with the autogold command.
 //
 // If the input value is of type Raw, its contents will be directly used instead of the value being
-// formatted as a Go literal.
+// formatted as a Go literal. The Format option may be used to write values as e.g. JSON instead.
+//
+// The HashOnly option may be used to store only a digest of very large values.
+//
+// If ExpectFile is called more than once in the same test without the Name option, the second call
+// uses `testdata/<test name>.2.golden`, the third `testdata/<test name>.3.golden`, and so on.
 func ExpectFile(t *testing.T, got interface{}, opts ...Option) {
-	dir := testdataDir(opts)
-	fileName := testName(t, opts)
-	outFile := filepath.Join(dir, fileName+".golden")
-
-	// At this point dir may be "testdata/" while outFile may be "testdata/TestFoo/subTest.golden".
-	// Reconcile this situation so we can rely on dir for e.g. removing unused .golden files in it,
-	// locking it (instead of the entire "testdata/" directory), etc.
-	dir = filepath.Dir(outFile)
-
-	// grabLock will acquire a directory-level lock to prevent concurrent mutations to the .golden
-	// files by parallel tests (whether in-process, or not.)
-	var goldenFilesUnlock func() error
-	grabLock := func() {
-		if goldenFilesUnlock != nil {
-			return
-		}
-		var err error
-		goldenFilesUnlock, err = acquirePathLock(dir)
-		if err != nil {
-			t.Fatal(err)
-		}
+	ext := fileFormat(opts).extension()
+	if hashOnly(opts) {
+		ext = hashExtension
 	}
-	unlock := func() {
-		if goldenFilesUnlock != nil {
-			if err := goldenFilesUnlock(); err != nil {
-				t.Fatal(err)
-			}
-			goldenFilesUnlock = nil
-		}
-	}
-	defer unlock()
-
-	if shouldCleanup() {
-		cleanMu.Lock()
-		if err := mkTempDir(dir); err != nil {
-			t.Fatal(err)
-		}
-		grabLock()
-
-		// cleanDir may not be set until mkTempDir(), so we can't assign this earlier
-		tmpdir := filepath.Join(cleanDir, dir)
-
-		_, ok := cleaned[dir]
-		if !ok {
-			// Move all .golden files in the directory into the temp dir.
-			cleaned[dir] = struct{}{}
-			matches, err := filepath.Glob(filepath.Join(dir, "*.golden"))
-			if err != nil {
-				cleanMu.Unlock()
-				t.Fatal(err)
-			}
+	golden := openGoldenFile(t, opts, goldenPath(t, opts, ext))
+	defer golden.close()
 
-			if err := os.MkdirAll(tmpdir, 0o700); err != nil {
-				cleanMu.Unlock()
-				t.Fatal(err)
-			}
-
-			for _, match := range matches {
-				err := os.Rename(match, filepath.Join(tmpdir, filepath.Base(match)))
-				if err != nil {
-					cleanMu.Unlock()
-					t.Fatal(err)
-				}
-			}
-		}
-
-		cleanMu.Unlock()
+	want := golden.read()
 
-		// Move the golden file for this test back into the testdata dir, if it exists.
-		tmpFile := filepath.Join(tmpdir, filepath.Base(fileName+".golden"))
-		err := os.Rename(tmpFile, outFile)
-		if err != nil && !os.IsNotExist(err) {
-			t.Fatal(err)
-		}
-		unlock() // don't hold the lock while we perform IO, diffing, etc. below.
-	}
-
-	want, err := ioutil.ReadFile(outFile)
-	if err != nil && !os.IsNotExist(err) {
+	opts = append(opts, &option{allowRaw: true, trailingNewline: true})
+	gotString, err := formatFile(got, opts)
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	opts = append(opts, &option{allowRaw: true, trailingNewline: true})
-	gotString := stringify(got, opts)
-	diff := diff(gotString, string(want), opts)
-
 	_, isRaw := got.(Raw)
 	isEmptyFile := isRaw && gotString == ""
+
+	// Hash-only golden files contain a digest of the output, which is compared as plain text.
+	output, diffOpts := gotString, opts
+	if hashOnly(opts) {
+		gotString, diffOpts = goldenDigest(output), nil
+	}
+	diff := diff(gotString, string(want), diffOpts)
+	if diff != "" && hashOnly(opts) && (*failOnUpdate || !update()) {
+		diff += fmt.Sprintf("\nfull output written to %s", writeArtifact(t, golden.path, output, opts))
+	}
+
 	if isEmptyFile && shouldCleanup() {
-		grabLock()
-		os.Remove(outFile)
+		golden.remove()
 	}
 	if diff != "" {
 		if update() {
-			grabLock()
-			if _, err := os.Stat(dir); os.IsNotExist(err) {
-				if err := os.MkdirAll(dir, 0o700); err != nil {
-					t.Fatal(err)
-				}
-			}
-			if err := ioutil.WriteFile(outFile, []byte(gotString), 0o666); err != nil {
-				t.Fatal(err)
-			}
+			golden.write([]byte(gotString))
 		}
 		if *failOnUpdate || !update() {
 			t.Log(fmt.Errorf("mismatch (-want +got):\n%s", colorDiff(diff)))
@@ -186,80 +177,143 @@ type pathLock struct {
 	lockfile  lockfile.Lockfile
 }
 
+const (
+	// defaultLockTimeout is how long acquirePathLock waits for a lock held by another process, unless
+	// specified by the AUTOGOLD_LOCK_TIMEOUT environment variable.
+	defaultLockTimeout = 30 * time.Second
+
+	// staleLockAge is the age after which a lockfile is considered stale, and removed. Locks are
+	// only held briefly, so this only happens if the PID of a killed process was reused.
+	staleLockAge = 10 * time.Minute
+)
+
+// lockTimeout returns how long to wait for a lock held by another process, as specified by the
+// AUTOGOLD_LOCK_TIMEOUT environment variable (e.g. "2m").
+func lockTimeout() (time.Duration, error) {
+	v := os.Getenv("AUTOGOLD_LOCK_TIMEOUT")
+	if v == "" {
+		return defaultLockTimeout, nil
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AUTOGOLD_LOCK_TIMEOUT: %v", err)
+	}
+	return timeout, nil
+}
+
+// lockPath returns the path of the lockfile for the given absolute path, which is stored in the
+// directory specified by the AUTOGOLD_LOCK_DIR environment variable or the OS temp dir. All
+// processes which may modify the same golden files must use the same lock directory.
+func lockPath(path string) string {
+	dir := os.Getenv("AUTOGOLD_LOCK_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	sha := fmt.Sprintf("%x", sha256.Sum256([]byte(path)))
+	pathHash := string(sha[:7])
+	return filepath.Join(dir, "autogold."+pathHash)
+}
+
 // acquirePathLock acquires a PID-based lockfile for the given path, which will be made into an
 // absolute path.
 //
+// If the lock is held by another process, it is retried with backoff until the lock timeout (see
+// lockTimeout) expires. Lockfiles of processes which no longer exist are removed automatically.
+//
 // The returned function unlocks the lock.
 func acquirePathLock(path string) (func() error, error) {
 	path, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
 	}
-	sha := fmt.Sprintf("%x", sha256.Sum256([]byte(path)))
-	pathHash := string(sha[:7])
-	lockPath := filepath.Join(os.TempDir(), "autogold."+pathHash)
+	timeout, err := lockTimeout()
+	if err != nil {
+		return nil, err
+	}
+	lockFile, err := filepath.Abs(lockPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0o700); err != nil {
+		return nil, err
+	}
 
 	pathLocksMu.Lock()
-	lock, inProcessAlready := pathLocks[lockPath]
+	lock, inProcessAlready := pathLocks[lockFile]
 	if !inProcessAlready {
-		lockfile, err := lockfile.New(lockPath)
+		lockfile, err := lockfile.New(lockFile)
 		if err != nil {
 			pathLocksMu.Unlock()
 			return nil, err
 		}
 		lock = &pathLock{lockfile: lockfile}
-		pathLocks[lockPath] = lock
+		pathLocks[lockFile] = lock
 	}
 	pathLocksMu.Unlock()
 
 	// Must not have multiple goroutines own the lockfile.
 	lock.ownership.Lock()
-	if err := lock.lockfile.TryLock(); err != nil {
+	if err := tryLockWithBackoff(lock.lockfile, timeout); err != nil {
 		lock.ownership.Unlock()
-		return nil, err
+		return nil, fmt.Errorf("autogold: locking %s: %w", path, err)
 	}
 	return func() error {
 		defer lock.ownership.Unlock()
 		if err := lock.lockfile.Unlock(); err != nil {
-			return fmt.Errorf("failed to unlock %q, reason: %v (you may need to delete the file)", lock.lockfile, err)
+			return fmt.Errorf("failed to unlock %q, reason: %v", lock.lockfile, err)
 		}
 		return nil
 	}, nil
 }
 
-func shouldCleanup() bool {
-	if !*clean {
-		return false
-	}
-	for _, arg := range os.Args {
-		if strings.HasPrefix(arg, "-test.run") {
-			// Running a subset of the tests, so don't remove unused files.
-			return false
+// tryLockWithBackoff tries to acquire the lockfile until the timeout expires, retrying with
+// exponential backoff while it is held by another process.
+func tryLockWithBackoff(l lockfile.Lockfile, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 5 * time.Millisecond
+	for {
+		err := l.TryLock()
+		if err == nil {
+			return nil
+		}
+		var temporary interface{ Temporary() bool }
+		if !errors.As(err, &temporary) || !temporary.Temporary() {
+			return err
 		}
-	}
-	return true
-}
-
-func mkTempDir(testDataDir string) error {
-	if cleanDir != "" {
-		return nil
-	}
 
-	// The tmp dir will be `testdata/foo.autogold.tmp` or `testdata.autogold.tmp` (depending on testdata
-	// folder name.)
-	tmpDir := testDataDir + ".autogold.tmp"
+		// The owner's PID may have been reused by another process after it was killed.
+		if info, statErr := os.Stat(string(l)); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			if removeErr := os.Remove(string(l)); removeErr == nil || os.IsNotExist(removeErr) {
+				continue
+			}
+		}
 
-	// The dir may have been left behind if a past test run exited early, so remove it.
-	if err := os.RemoveAll(tmpDir); err != nil && !os.IsNotExist(err) {
-		return err
+		if time.Now().After(deadline) {
+			owner := "another process"
+			if proc, ownerErr := l.GetOwner(); ownerErr == nil {
+				owner = fmt.Sprintf("process %d", proc.Pid)
+			}
+			return fmt.Errorf("timed out after %v waiting for lockfile %s held by %s (see AUTOGOLD_LOCK_TIMEOUT)", timeout, l, owner)
+		}
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		if remaining := time.Until(deadline); sleep > remaining {
+			sleep = remaining
+		}
+		time.Sleep(sleep)
+		if backoff < 250*time.Millisecond {
+			backoff *= 2
+		}
 	}
+}
 
-	// Create the tmp dir.
-	if err := os.Mkdir(tmpDir, os.ModePerm); err != nil {
-		return err
-	}
-	cleanDir = tmpDir
-	return nil
+func shouldCleanup() bool {
+	return *clean
+}
+
+// shouldRecordUsage reports whether the golden files used by tests should be recorded, in order to
+// remove (or move those of renamed tests) or report those which are unused.
+func shouldRecordUsage() bool {
+	return *clean || *reportUnused || *failOnUnused
 }
 
 func testName(t *testing.T, opts []Option) string {
@@ -279,5 +333,5 @@ func testdataDir(opts []Option) string {
 			return opt.dir
 		}
 	}
-	return "testdata"
+	return naming.DefaultDir
 }
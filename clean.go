@@ -0,0 +1,512 @@
+package autogold
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/naming"
+	"github.com/hexops/autogold/v2/internal/pending"
+)
+
+// Run runs the tests and, if `-clean` is specified and all tests passed, removes the golden files
+// which were not used by any test. It returns the exit code to pass to os.Exit, so that it can be
+// called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(autogold.Run(m))
+//	}
+//
+// Unused golden files are removed from the directories of all golden files used by the tests, and
+// recursively from the golden file roots (e.g. "testdata" and those given by the Dir option) so
+// that golden files of subtests which no longer exist are removed along with their directories.
+// The contents of golden directories used by ExpectDir are left as-is.
+//
+// If only some tests run (due to the -run or -skip flags), only the golden files of tests which ran
+// and used golden files are removed. Golden files outside of the roots are left as-is in that case.
+//
+// Golden files are never removed while tests are running, or if any test fails or the test binary
+// exits early (e.g. due to a panic or timeout), so an interrupted run never loses golden files.
+//
+// When `-update` and `-clean` are specified, golden files created by tests are compared against
+// the unused golden files, and those with identical or similar contents (i.e. the golden files of
+// renamed tests) are moved to their new location and reported, rather than removed. This is not
+// done for `-update=pending`.
+//
+// If `-report-unused` is specified instead, the unused golden files are listed but not removed.
+// `-fail-on-unused` additionally fails the run if there are any, e.g. to flag stale golden files in
+// CI.
+//
+// Without Run, `-clean`, `-report-unused` and `-fail-on-unused` fail the first test which uses
+// golden files.
+func Run(m *testing.M) int {
+	running = true
+	code := m.Run()
+	if !shouldRecordUsage() {
+		return code
+	}
+	if code != 0 {
+		fmt.Println("autogold: tests failed, not checking for unused golden files")
+		return code
+	}
+	filter, err := flagTestFilter()
+	if err != nil {
+		fmt.Println("autogold: invalid test filter:", err)
+		return 1
+	}
+	return journal.finish(os.Stdout, filter)
+}
+
+// finish renames, removes or reports the unused golden files as specified by the flags once all
+// tests have passed, writing what it does to w. It returns the exit code of the test binary.
+func (j *cleanJournal) finish(w io.Writer, filter *testFilter) int {
+	unused, err := j.unused(filter)
+	if err != nil {
+		fmt.Fprintln(w, "autogold: finding unused golden files:", err)
+		return 1
+	}
+
+	// Renamed golden files are only moved when unused golden files would be removed otherwise, as
+	// golden files of tests which did not use them (e.g. skipped tests) are also unused. Pending
+	// updates must not modify golden files.
+	if update() && !pendingUpdate() && shouldCleanup() {
+		renames, err := j.renames(unused)
+		if err != nil {
+			fmt.Fprintln(w, "autogold: detecting renamed golden files:", err)
+			return 1
+		}
+		for _, r := range renames {
+			if err := j.rename(r); err != nil {
+				fmt.Fprintln(w, "autogold: renaming golden file:", err)
+				return 1
+			}
+			fmt.Fprintln(w, "autogold:", r)
+		}
+		unused = withoutRenamed(unused, renames)
+	}
+
+	if shouldCleanup() {
+		removed, err := j.remove(unused)
+		for _, path := range removed {
+			fmt.Fprintln(w, "autogold: removed unused golden file", path)
+		}
+		if err != nil {
+			fmt.Fprintln(w, "autogold: removing unused golden files:", err)
+			return 1
+		}
+		return 0
+	}
+	if !*reportUnused && !*failOnUnused {
+		return 0
+	}
+	for _, path := range unused {
+		fmt.Fprintln(w, "autogold: unused golden file", path)
+	}
+	if len(unused) > 0 && *failOnUnused {
+		fmt.Fprintf(w, "autogold: FAIL: %d unused golden files (use -clean to remove them)\n", len(unused))
+		return 1
+	}
+	return 0
+}
+
+var (
+	// running indicates whether the tests are being run by Run.
+	running bool
+
+	// withoutRunReported indicates whether a test has been failed because -clean, -report-unused
+	// or -fail-on-unused was specified without using Run, so that only the first test using golden
+	// files fails.
+	withoutRunReported atomic.Bool
+
+	// journal records the golden files used by the tests.
+	journal = newCleanJournal()
+)
+
+// cleanJournal records the golden files used by tests, and the directories containing them, so that
+// the unused golden files in those directories can be removed once all tests have passed.
+type cleanJournal struct {
+	mu sync.Mutex
+
+	// patterns are the glob patterns (e.g. "testdata/*.golden") matching golden files which may
+	// be removed if unused.
+	patterns map[string]struct{}
+
+	// used are the paths of golden files used by tests.
+	used map[string]struct{}
+
+	// usedTrees are the paths of golden directories (see ExpectDir) used by tests, all files in
+	// which are considered used.
+	usedTrees map[string]struct{}
+
+	// created are the paths of golden files created by tests, i.e. which did not exist before.
+	created map[string]struct{}
+
+	// roots are the directories which golden files are stored in (e.g. "testdata"), including in
+	// subdirectories for subtests, in which unused golden files are removed recursively.
+	roots map[string]struct{}
+
+	// tests are the (sanitized) names of the top-level tests which used golden files.
+	tests map[string]struct{}
+}
+
+func newCleanJournal() *cleanJournal {
+	return &cleanJournal{
+		patterns:  map[string]struct{}{},
+		used:      map[string]struct{}{},
+		usedTrees: map[string]struct{}{},
+		roots:     map[string]struct{}{},
+		created:   map[string]struct{}{},
+		tests:     map[string]struct{}{},
+	}
+}
+
+// use records that the golden file at path was used by the named test.
+func (j *cleanJournal) use(test, path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.useTest(test)
+	path = filepath.Clean(path)
+	j.used[path] = struct{}{}
+	for _, pattern := range goldenPatterns(path) {
+		j.patterns[filepath.Join(filepath.Dir(path), pattern)] = struct{}{}
+	}
+}
+
+// create records that the golden file at path was created by a test.
+func (j *cleanJournal) create(path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.created[filepath.Clean(path)] = struct{}{}
+}
+
+// useTree records that the golden directory at dir was used by the named test.
+func (j *cleanJournal) useTree(test, dir string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.useTest(test)
+	j.usedTrees[filepath.Clean(dir)] = struct{}{}
+}
+
+// useTest records that the named test (or one of its subtests) used golden files. j.mu must be
+// held.
+func (j *cleanJournal) useTest(test string) {
+	top, _, _ := strings.Cut(test, "/")
+	j.tests[sanitizeName(top)] = struct{}{}
+}
+
+// useRoot records that golden files are stored in the directory root, and its subdirectories.
+func (j *cleanJournal) useRoot(root string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.roots[filepath.Clean(root)] = struct{}{}
+}
+
+// isUsed reports whether the golden file at path was used by a test.
+func (j *cleanJournal) isUsed(path string) bool {
+	if _, ok := j.used[path]; ok {
+		return true
+	}
+	for tree := range j.usedTrees {
+		if strings.HasPrefix(path, tree+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unused returns the paths of the golden files which were not used by any test, in the roots and
+// in the directories of those that were used. If only some tests ran (see testFilter), only the
+// golden files of tests which ran are considered.
+//
+// Only files with the extensions of golden files autogold writes are removed from the roots and
+// their subdirectories, and only from subdirectories named after a test (see inTestTree). As other files (e.g. test inputs) may share a custom extension (see
+// PathTemplate), files with custom extensions are only removed from the directories of used golden
+// files with the same extension, and only if they belong to a test which used golden files.
+func (j *cleanJournal) unused(filter *testFilter) ([]string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	seen := map[string]struct{}{}
+	var unused []string
+	add := func(path string) {
+		if _, ok := seen[path]; ok || j.isUsed(path) || !j.ran(filter, path) {
+			return
+		}
+		seen[path] = struct{}{}
+		unused = append(unused, path)
+	}
+	for pattern := range j.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if isGoldenFile(match) || j.belongsToUsingTest(match) {
+				add(match)
+			}
+		}
+	}
+	for root := range j.roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if _, used := j.usedTrees[path]; used || strings.HasSuffix(path, ".autogold.tmp") {
+					return filepath.SkipDir
+				}
+				// The proposed golden directory of a golden directory, see ExpectDir.
+				if _, used := j.usedTrees[strings.TrimSuffix(path, pending.Suffix)]; used {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isGoldenFile(path) && j.inTestTree(root, path) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+// inTestTree reports whether the file at path, within root, is directly in root or in a
+// subdirectory named after a test (e.g. "testdata/TestFoo/sub.golden"), so that golden files of
+// subtests are removed but files in other subdirectories (e.g. "testdata/fixtures/expected.golden")
+// are left alone. j.mu must be held.
+func (j *cleanJournal) inTestTree(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	top, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+	if !nested {
+		return true
+	}
+	if _, used := j.tests[top]; used {
+		return true
+	}
+	return naming.IsTestFunc(top, "Test") || naming.IsTestFunc(top, "Fuzz")
+}
+
+// remove removes the given (unused) golden files and the directories in the roots left empty,
+// returning the paths of the removed files.
+func (j *cleanJournal) remove(unused []string) ([]string, error) {
+	var removed []string
+	for _, path := range unused {
+		unlock, err := acquirePathLock(filepath.Dir(path))
+		if err != nil {
+			return removed, err
+		}
+		err = os.Remove(path)
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, path)
+
+		if err := j.pruneEmptyDirs(path); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// pruneEmptyDirs removes the parent directories of the removed golden file at path which are left
+// empty, up to its root.
+func (j *cleanJournal) pruneEmptyDirs(path string) error {
+	j.mu.Lock()
+	root, ok := j.rootOf(path)
+	j.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return (osStore{}).pruneEmptyDirs(root, path)
+}
+
+// rootOf returns the innermost root containing path. j.mu must be held.
+func (j *cleanJournal) rootOf(path string) (root string, ok bool) {
+	for r := range j.roots {
+		if strings.HasPrefix(path, r+string(filepath.Separator)) && len(r) >= len(root) {
+			root, ok = r, true
+		}
+	}
+	return root, ok
+}
+
+// ran reports whether the test which the golden file at path belongs to ran, according to the
+// filter. Golden files outside of the roots cannot be attributed to a test, so they are only
+// considered to have run if all tests ran. j.mu must be held.
+//
+// As golden files named using the Name option may match the filter without belonging to a test
+// which ran (e.g. "TestFoo_shared" for `-run TestFoo`), the top-level test must also have used
+// golden files.
+func (j *cleanJournal) ran(filter *testFilter, path string) bool {
+	if filter == nil {
+		return true
+	}
+	root, ok := j.rootOf(path)
+	if !ok {
+		return false
+	}
+	name, ok := goldenTestName(root, path)
+	return ok && j.belongsToUsingTest(path) && filter.ran(name)
+}
+
+// belongsToUsingTest reports whether the file at path, within a root, is named after a top-level
+// test (or one of its subtests) which used golden files. j.mu must be held.
+func (j *cleanJournal) belongsToUsingTest(path string) bool {
+	root, ok := j.rootOf(path)
+	if !ok {
+		return false
+	}
+	name, ok := goldenTestName(root, path)
+	if !ok {
+		return false
+	}
+	top, _, _ := strings.Cut(name, "/")
+	_, used := j.tests[top]
+	return used
+}
+
+// isGoldenFile reports whether path has the extension of a golden file autogold writes.
+func isGoldenFile(path string) bool {
+	return naming.IsGolden(path)
+}
+
+// recordCleanup records that the golden file at path is used by the test, if -clean is specified.
+func recordCleanup(t *testing.T, path string) {
+	if cleanupEnabled(t) {
+		journal.use(t.Name(), path)
+	}
+}
+
+// recordCreated records that the golden file at path was created by the test, if unused golden
+// files are being checked for.
+func recordCreated(t *testing.T, path string) {
+	if cleanupEnabled(t) {
+		journal.create(path)
+	}
+}
+
+// recordCleanupTree records that the golden directory at dir is used by the test, if -clean is
+// specified.
+func recordCleanupTree(t *testing.T, dir string) {
+	if cleanupEnabled(t) {
+		journal.useTree(t.Name(), dir)
+	}
+}
+
+// recordCleanupRoot records that golden files are stored in the directory root and its
+// subdirectories, if -clean is specified.
+func recordCleanupRoot(t *testing.T, root string) {
+	if cleanupEnabled(t) {
+		journal.useRoot(root)
+	}
+}
+
+// cleanupEnabled reports whether golden file usage should be recorded for -clean, -report-unused
+// or -fail-on-unused. If they are specified without using Run, the first test to use golden files
+// fails, as they would otherwise silently have no effect.
+func cleanupEnabled(t *testing.T) bool {
+	if !shouldRecordUsage() {
+		return false
+	}
+	if !running {
+		if !withoutRunReported.Swap(true) {
+			t.Fatal(withoutRunError())
+		}
+		return false
+	}
+	return true
+}
+
+// withoutRunError returns the error reported when -clean, -report-unused or -fail-on-unused are
+// specified without using Run.
+func withoutRunError() error {
+	var flags []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"-clean", *clean}, {"-report-unused", *reportUnused}, {"-fail-on-unused", *failOnUnused}} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return fmt.Errorf("autogold: %s can only be used when TestMain calls os.Exit(autogold.Run(m))", strings.Join(flags, " and "))
+}
+
+var (
+	legacyRestoreMu sync.Mutex
+	legacyRestored  = map[string]struct{}{}
+)
+
+// restoreLegacyCleanDir restores golden files left behind in a `<dir>.autogold.tmp` directory, for
+// dir or any of its parents within the package directory, by a previous version of autogold whose
+// -clean implementation moved golden files there during the test run and was interrupted.
+//
+// Files which have since been recreated are not overwritten.
+func restoreLegacyCleanDir(t *testing.T, dir string) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyRestoreMu.Lock()
+	defer legacyRestoreMu.Unlock()
+	for strings.HasPrefix(dir, pwd+string(filepath.Separator)) {
+		if _, ok := legacyRestored[dir]; ok {
+			return
+		}
+		legacyRestored[dir] = struct{}{}
+
+		tmpDir := dir + ".autogold.tmp"
+		if _, err := os.Stat(tmpDir); err == nil {
+			if err := restoreLegacyCleanFiles(tmpDir); err != nil {
+				t.Fatal(fmt.Errorf("autogold: restoring golden files from %s: %w", tmpDir, err))
+			}
+			t.Logf("autogold: restored golden files left behind in %s by an interrupted -clean", tmpDir)
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+func restoreLegacyCleanFiles(tmpDir string) error {
+	err := filepath.WalkDir(tmpDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// The golden files were moved to `<tmpDir>/<original path>`.
+		original, err := filepath.Rel(tmpDir, path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(original); err == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(original), 0o700); err != nil {
+			return err
+		}
+		return os.Rename(path, original)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(tmpDir)
+}
@@ -0,0 +1,273 @@
+package autogold
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(Run(m))
+}
+
+func removeUnused(t *testing.T, j *cleanJournal, filter *testFilter) ([]string, error) {
+	unused, err := j.unused(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j.remove(unused)
+}
+
+func Test_cleanJournal(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.golden":            "a",
+		"TestB.golden":            "b",
+		"TestB.golden.json":       "{}",
+		"input.json":              "{}",
+		"TestC/sub.golden":        "c",
+		"TestD/out.txt":           "d",
+		"TestD/nested/out.golden": "d",
+	})
+	j := newCleanJournal()
+	j.use("TestA", filepath.Join(dir, "TestA.golden"))
+	j.useTree("TestD", filepath.Join(dir, "TestD"))
+
+	removed, err := removeUnused(t, j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "TestB.golden"), filepath.Join(dir, "TestB.golden.json")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatal("\ngot:\n", removed, "\nwant:\n", want)
+	}
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := map[string]string{
+		"TestA.golden":            "a",
+		"input.json":              "{}",
+		"TestC/sub.golden":        "c",
+		"TestD/out.txt":           "d",
+		"TestD/nested/out.golden": "d",
+	}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", wantFiles)
+	}
+
+	// Golden files of subtests which no longer exist are removed from the roots recursively, along
+	// with the directories left empty.
+	j.useRoot(dir)
+	removed, err = removeUnused(t, j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{filepath.Join(dir, "TestC", "sub.golden")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatal("\ngot:\n", removed, "\nwant:\n", want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "TestC")); !os.IsNotExist(err) {
+		t.Fatal("expected empty directory to be removed, got", err)
+	}
+}
+
+func Test_cleanJournal_filter(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.golden":        "a",
+		"TestA/old.golden":    "a",
+		"TestB.golden":        "b",
+		"TestB/old.golden":    "b",
+		"TestBar/x.golden":    "b",
+		"TestB/skip.golden":   "b",
+		"TestB_shared.golden": "b",
+	})
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestB", filepath.Join(dir, "TestB.golden"))
+
+	// TestB_shared.golden, e.g. named using Name("TestB_shared") by another test, matches an
+	// unanchored -run TestB but is not removed as TestB_shared did not run.
+	filter, err := newTestFilter("TestB", "TestB/skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := removeUnused(t, j, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "TestB", "old.golden")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatal("\ngot:\n", removed, "\nwant:\n", want)
+	}
+}
+
+func Test_cleanJournal_nonTestDirs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"TestA.golden":              "a",
+		"TestGone/sub.golden":       "a",
+		"FuzzGone/sub.golden":       "a",
+		"Testlower/sub.golden":      "a",
+		"fixtures/expected.golden":  "a",
+		"fixtures/nested/x.golden":  "a",
+		"my_shared_name/sub.golden": "a",
+	}
+	testutil.WriteFiles(t, dir, files)
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestA", filepath.Join(dir, "TestA.golden"))
+	j.use("my_shared_name", filepath.Join(dir, "my_shared_name", "used.golden"))
+
+	// Only golden files in subdirectories named after a test (or one which used golden files) are
+	// removed, as other subdirectories (e.g. test fixtures) may contain files with golden
+	// extensions.
+	removed, err := removeUnused(t, j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "FuzzGone", "sub.golden"),
+		filepath.Join(dir, "TestGone", "sub.golden"),
+		filepath.Join(dir, "my_shared_name", "sub.golden"),
+	}
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatal("\ngot:\n", removed, "\nwant:\n", want)
+	}
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := map[string]string{
+		"TestA.golden":             "a",
+		"Testlower/sub.golden":     "a",
+		"fixtures/expected.golden": "a",
+		"fixtures/nested/x.golden": "a",
+	}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", wantFiles)
+	}
+}
+
+func Test_cleanJournal_customExtension(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.json":       "{}",
+		"TestA.2.json":     "{}",
+		"TestA/old.json":   "{}",
+		"TestGone.json":    "{}",
+		"input.json":       "{}",
+		"TestA/input.yaml": "a: 1",
+	})
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestA", filepath.Join(dir, "TestA.json"))
+
+	// Only files named after a test which used golden files are removed, as other files (e.g. test
+	// inputs) may share the custom extension.
+	removed, err := removeUnused(t, j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "TestA.2.json")}
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatal("\ngot:\n", removed, "\nwant:\n", want)
+	}
+}
+
+func Test_cleanJournal_reportUnused(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"TestA.golden":        "a",
+		"TestGone.golden":     "gone",
+		"TestGone/sub.golden": "gone",
+	}
+	testutil.WriteFiles(t, dir, files)
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestA", filepath.Join(dir, "TestA.golden"))
+	setFlag(t, "update", "false")
+	setFlag(t, "clean", "false")
+	setFlag(t, "report-unused", "true")
+
+	unused := "autogold: unused golden file " + filepath.Join(dir, "TestGone.golden") + "\n" +
+		"autogold: unused golden file " + filepath.Join(dir, "TestGone", "sub.golden") + "\n"
+	var out strings.Builder
+	if code := j.finish(&out, nil); code != 0 || out.String() != unused {
+		t.Fatal("\ngot:\n", out.String(), code, "\nwant:\n", unused, 0)
+	}
+
+	setFlag(t, "report-unused", "false")
+	setFlag(t, "fail-on-unused", "true")
+	out.Reset()
+	want := unused + "autogold: FAIL: 2 unused golden files (use -clean to remove them)\n"
+	if code := j.finish(&out, nil); code != 1 || out.String() != want {
+		t.Fatal("\ngot:\n", out.String(), code, "\nwant:\n", want, 1)
+	}
+
+	// The unused golden files are only reported, not removed.
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", files)
+	}
+}
+
+func Test_withoutRunError(t *testing.T) {
+	setFlag(t, "clean", "true")
+	want := "autogold: -clean can only be used when TestMain calls os.Exit(autogold.Run(m))"
+	if err := withoutRunError(); err.Error() != want {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", want)
+	}
+	setFlag(t, "clean", "false")
+	setFlag(t, "report-unused", "true")
+	setFlag(t, "fail-on-unused", "true")
+	want = "autogold: -report-unused and -fail-on-unused can only be used when TestMain calls os.Exit(autogold.Run(m))"
+	if err := withoutRunError(); err.Error() != want {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", want)
+	}
+}
+
+func Test_restoreLegacyCleanDir(t *testing.T) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(pwd)
+
+	// A previous, interrupted `-clean` run moved the golden files of testdata/ and testdata/TestB/
+	// into testdata.autogold.tmp/, and TestA.golden has since been recreated.
+	testutil.WriteFiles(t, ".", map[string]string{
+		"testdata/TestA.golden":                             "new a",
+		"testdata.autogold.tmp/testdata/TestA.golden":       "old a",
+		"testdata.autogold.tmp/testdata/TestC.golden":       "c",
+		"testdata.autogold.tmp/testdata/TestB/sub.golden":   "b",
+		"testdata.autogold.tmp/testdata/TestB/other.golden": "b",
+	})
+	restoreLegacyCleanDir(t, filepath.Join("testdata", "TestB"))
+
+	got, err := readDirFiles(OSStore(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"testdata/TestA.golden":       "new a",
+		"testdata/TestC.golden":       "c",
+		"testdata/TestB/sub.golden":   "b",
+		"testdata/TestB/other.golden": "b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hexops/autogold/v2/internal/naming"
+	"github.com/hexops/autogold/v2/internal/pending"
+)
+
+// pkgGoldens describes the golden files of a package, found statically: golden files are those in
+// the package's testdata directory, and are owned by the test function they are named after (see
+// naming.TestName). Golden files written elsewhere using the Dir, PathFunc or PathTemplate options
+// are not found.
+type pkgGoldens struct {
+	dir string
+
+	// tests are the names of the test functions of the package, and names are those given to the
+	// autogold.Name option, sanitized like golden file names.
+	tests, names map[string]bool
+
+	goldens []golden
+	pending []pending.Snapshot
+}
+
+// golden is a golden file of a package.
+type golden struct {
+	path string
+	size int64
+
+	// test is the (sanitized) name of the test which the golden file belongs to, e.g. "TestFoo/sub".
+	test string
+
+	// owned indicates the test function the golden file belongs to exists.
+	owned bool
+}
+
+// unused returns the golden files of the package which do not belong to any test function.
+func (p *pkgGoldens) unused() []golden {
+	var unused []golden
+	for _, g := range p.goldens {
+		if !g.owned {
+			unused = append(unused, g)
+		}
+	}
+	return unused
+}
+
+// loadPackages loads the golden files of the packages in the given directories. Like the go tool, a
+// directory ending in "/..." matches all packages in it recursively.
+func loadPackages(patterns []string) ([]*pkgGoldens, error) {
+	var pkgs []*pkgGoldens
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		dirs := []string{pattern}
+		if dir, ok := recursivePattern(pattern); ok {
+			var err error
+			if dirs, err = testPackageDirs(dir); err != nil {
+				return nil, err
+			}
+		}
+		for _, dir := range dirs {
+			dir = filepath.Clean(dir)
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			pkg, err := loadPackage(dir)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// recursivePattern reports whether pattern is of the form "dir/...", returning dir.
+func recursivePattern(pattern string) (string, bool) {
+	if pattern == "..." {
+		return ".", true
+	}
+	dir := strings.TrimSuffix(filepath.ToSlash(pattern), "/...")
+	return filepath.FromSlash(dir), dir != filepath.ToSlash(pattern)
+}
+
+// testPackageDirs returns the directories in root, recursively, which contain _test.go files.
+// testdata and vendor directories, and those whose names begin with "." or "_", are skipped like
+// the go tool does.
+func testPackageDirs(root string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if dir := filepath.Dir(path); strings.HasSuffix(path, "_test.go") && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// loadPackage loads the golden files of the package in dir.
+func loadPackage(dir string) (*pkgGoldens, error) {
+	tests, names, err := testNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &pkgGoldens{dir: dir, tests: tests, names: names}
+
+	root := filepath.Join(dir, naming.DefaultDir)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if strings.HasSuffix(path, ".autogold.tmp") || strings.HasSuffix(path, pending.Suffix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !naming.IsGolden(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, _ := naming.TestName(root, path)
+		top, _, _ := strings.Cut(name, "/")
+		pkg.goldens = append(pkg.goldens, golden{path: path, size: info.Size(), test: name, owned: tests[top] || names[top]})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	snapshots, err := pending.Find(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snapshots {
+		// Pending snapshots of packages in subdirectories belong to those packages.
+		if filepath.Dir(s.Target) == dir || strings.HasPrefix(s.Path, root+string(filepath.Separator)) {
+			pkg.pending = append(pkg.pending, s)
+		}
+	}
+	return pkg, nil
+}
+
+// testNames returns the names of the test and fuzz functions in the _test.go files in dir, and the
+// constant names given to the autogold.Name option, sanitized like golden file names (see
+// naming.Sanitize.)
+func testNames(dir string) (tests, names map[string]bool, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+	tests, names = map[string]bool{}, map[string]bool{}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			if name := fn.Name.Name; naming.IsTestFunc(name, "Test") || naming.IsTestFunc(name, "Fuzz") {
+				tests[naming.Sanitize(name)] = true
+			}
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if name, ok := nameOption(n); ok {
+				top, _, _ := strings.Cut(naming.Sanitize(name), "/")
+				names[top] = true
+			}
+			return true
+		})
+	}
+	return tests, names, nil
+}
+
+// nameOption returns the name given to the autogold.Name option if n is a call to it with a
+// constant string.
+func nameOption(n ast.Node) (string, bool) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Name" {
+		return "", false
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "autogold" {
+		return "", false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	name, err := strconv.Unquote(lit.Value)
+	return name, err == nil
+}
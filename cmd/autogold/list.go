@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// list prints the golden files of the packages and the tests they belong to.
+func list(w io.Writer, pkgs []*pkgGoldens) int {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, pkg := range pkgs {
+		for _, g := range pkg.goldens {
+			test := g.test
+			if !g.owned {
+				test += " (unused)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", g.path, test)
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+// unused prints the golden files of the packages which do not belong to any test, returning exit
+// code 1 if there are any.
+func unused(w io.Writer, pkgs []*pkgGoldens) int {
+	code := 0
+	for _, pkg := range pkgs {
+		for _, g := range pkg.unused() {
+			fmt.Fprintln(w, g.path)
+			code = 1
+		}
+	}
+	return code
+}
+
+// stats prints statistics about the golden files of each package, and their totals.
+func stats(w io.Writer, pkgs []*pkgGoldens) int {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tTESTS\tGOLDEN FILES\tSIZE\tUNUSED\tPENDING")
+	var tests, goldens, unused, pendingSnapshots int
+	var size int64
+	for _, pkg := range pkgs {
+		var pkgSize int64
+		for _, g := range pkg.goldens {
+			pkgSize += g.size
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d\t%d\n", pkg.dir, len(pkg.tests), len(pkg.goldens), formatSize(pkgSize), len(pkg.unused()), len(pkg.pending))
+		tests += len(pkg.tests)
+		goldens += len(pkg.goldens)
+		size += pkgSize
+		unused += len(pkg.unused())
+		pendingSnapshots += len(pkg.pending)
+	}
+	if len(pkgs) > 1 {
+		fmt.Fprintf(tw, "total\t%d\t%d\t%s\t%d\t%d\n", tests, goldens, formatSize(size), unused, pendingSnapshots)
+	}
+	tw.Flush()
+	return 0
+}
+
+// formatSize formats a size in bytes for humans, e.g. "1.5 KiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,202 @@
+// Command autogold manages golden files, and reviews the pending snapshots written by
+// `go test -update=pending`: proposed golden files (`*.golden.new`), proposed golden directories
+// and patch files with proposed changes to autogold.Expect calls (`*_test.go.autogold.patch`).
+//
+// Usage:
+//
+//	autogold list [packages]            list golden files and the tests they belong to
+//	autogold unused [packages]          list golden files not belonging to any test
+//	autogold stats [packages]           show golden file statistics
+//	autogold pending [path...]          list pending snapshots
+//	autogold diff [path...]             show the changes pending snapshots propose
+//	autogold accept [-all] [path...]    apply pending snapshots
+//	autogold reject [-all] [path...]    discard pending snapshots
+//	autogold review -serve [packages]   review pending snapshots in the browser
+//
+// Packages are given as directories, which default to the current directory. Like the go tool,
+// "./..." matches all packages in the current directory recursively. The golden files of a package
+// are those in its testdata directory, which belong to the test function they are named after
+// (e.g. "testdata/TestFoo/sub.golden" belongs to TestFoo), or to the name given to the
+// autogold.Name option. This is determined statically, so golden files written elsewhere using the
+// Dir, PathFunc or PathTemplate options are not found; use `go test -report-unused` for those.
+//
+// For the other commands, a path may name a pending snapshot, the golden file, golden directory or
+// _test.go file it changes, or a directory to find pending snapshots in recursively. pending and
+// diff default to the current directory, while accept and reject require paths or -all.
+//
+// `autogold review -serve` runs `go test -update=pending` for the packages (unless -test=false is
+// given), so that mismatched snapshots become pending snapshots, and serves a page at -addr
+// (localhost on a random port by default) showing every pending snapshot with a side-by-side diff,
+// or a preview for image golden files, and buttons to accept or reject them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hexops/autogold/v2/internal/pending"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+const usage = `usage: autogold <command> [arguments]
+
+Commands:
+	list [packages]            list golden files and the tests they belong to
+	unused [packages]          list golden files not belonging to any test
+	stats [packages]           show golden file statistics
+	pending [path...]          list pending snapshots
+	diff [path...]             show the changes pending snapshots propose
+	accept [-all] [path...]    apply pending snapshots
+	reject [-all] [path...]    discard pending snapshots
+	review -serve [-addr addr] [-test=false] [packages]
+	                           review pending snapshots in the browser
+
+Packages are directories, and default to the current directory; "./..."
+matches all packages in it recursively.
+
+Pending snapshots are written by 'go test -update=pending'. A path may name a
+pending snapshot, the golden file or _test.go file it changes, or a directory
+to find pending snapshots in recursively.
+`
+
+// run runs the autogold command with the given arguments, returning the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	var (
+		all, serve, test bool
+		addr             string
+	)
+	switch cmd {
+	case "list", "unused", "stats", "pending", "diff":
+	case "accept", "reject":
+		flags.BoolVar(&all, "all", false, "apply to all pending snapshots in the current directory, recursively")
+	case "review":
+		flags.BoolVar(&serve, "serve", false, "serve the review page")
+		flags.StringVar(&addr, "addr", "localhost:0", "the address to serve the review page at")
+		flags.BoolVar(&test, "test", true, "run go test -update=pending first, so that mismatched snapshots become pending")
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "autogold: unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		if (cmd == "accept" || cmd == "reject") && !all {
+			fmt.Fprintf(stderr, "autogold %s: specify the snapshots to %s, or -all\n", cmd, cmd)
+			return 2
+		}
+		paths = []string{"."}
+	}
+
+	switch cmd {
+	case "review":
+		if !serve {
+			fmt.Fprintln(stderr, "autogold review: specify -serve to review pending snapshots in the browser")
+			return 2
+		}
+		return review(stdout, stderr, paths, addr, test)
+	case "list", "unused", "stats":
+		pkgs, err := loadPackages(paths)
+		if err != nil {
+			fmt.Fprintf(stderr, "autogold %s: %v\n", cmd, err)
+			return 1
+		}
+		switch cmd {
+		case "list":
+			return list(stdout, pkgs)
+		case "unused":
+			return unused(stdout, pkgs)
+		}
+		return stats(stdout, pkgs)
+	}
+
+	snapshots, err := resolve(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "autogold %s: %v\n", cmd, err)
+		return 1
+	}
+	code := 0
+	for _, s := range snapshots {
+		switch cmd {
+		case "pending":
+			status := ""
+			if _, err := os.Stat(s.Target); os.IsNotExist(err) {
+				status = " (new)"
+			}
+			fmt.Fprintf(stdout, "%s\t%s%s\n", s.Kind, s.Target, status)
+		case "diff":
+			diff, err := s.Diff()
+			if err != nil {
+				fmt.Fprintf(stderr, "autogold diff: %v\n", err)
+				code = 1
+				continue
+			}
+			fmt.Fprint(stdout, diff)
+		case "accept":
+			if err := s.Accept(); err != nil {
+				fmt.Fprintf(stderr, "autogold accept: %v\n", err)
+				code = 1
+				continue
+			}
+			fmt.Fprintf(stdout, "accepted %s\n", s.Target)
+		case "reject":
+			if err := s.Reject(); err != nil {
+				fmt.Fprintf(stderr, "autogold reject: %v\n", err)
+				code = 1
+				continue
+			}
+			fmt.Fprintf(stdout, "rejected %s\n", s.Target)
+		}
+	}
+	return code
+}
+
+// resolve returns the pending snapshots named by the given paths, see the package documentation.
+func resolve(paths []string) ([]pending.Snapshot, error) {
+	var snapshots []pending.Snapshot
+	seen := map[string]bool{}
+	add := func(s pending.Snapshot) {
+		if !seen[s.Path] {
+			seen[s.Path] = true
+			snapshots = append(snapshots, s)
+		}
+	}
+	for _, path := range paths {
+		if dir, ok := recursivePattern(path); ok {
+			path = dir
+		}
+		if s, err := pending.Open(path); err == nil {
+			add(s)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("no pending snapshot for %s", path)
+		}
+		found, err := pending.Find(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range found {
+			add(s)
+		}
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+// runCommand runs the autogold command in dir, returning its output with dir replaced by "$DIR".
+func runCommand(t *testing.T, dir string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return strings.ReplaceAll(stdout.String()+stderr.String(), dir, "$DIR"), code
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"testdata/TestA.golden":     "a\n",
+		"testdata/TestA.golden.new": "A\n",
+		"testdata/TestB.golden.new": "b\n",
+		"testdata/TestC.golden.new": "c\n",
+	})
+
+	for _, tc := range []struct {
+		args []string
+		want string
+		code int
+	}{
+		{
+			args: []string{"pending", dir},
+			want: "file\t$DIR/testdata/TestA.golden\nfile\t$DIR/testdata/TestB.golden (new)\nfile\t$DIR/testdata/TestC.golden (new)\n",
+		},
+		{
+			args: []string{"diff", filepath.Join(dir, "testdata", "TestA.golden")},
+			want: "--- $DIR/testdata/TestA.golden\n+++ $DIR/testdata/TestA.golden.new\n@@ -1 +1 @@\n-a\n+A\n",
+		},
+		{
+			args: []string{"accept"},
+			want: "autogold accept: specify the snapshots to accept, or -all\n",
+			code: 2,
+		},
+		{
+			args: []string{"accept", filepath.Join(dir, "testdata", "TestA.golden")},
+			want: "accepted $DIR/testdata/TestA.golden\n",
+		},
+		{
+			args: []string{"reject", filepath.Join(dir, "testdata", "TestB.golden.new")},
+			want: "rejected $DIR/testdata/TestB.golden\n",
+		},
+		{
+			args: []string{"reject", filepath.Join(dir, "testdata", "TestB.golden")},
+			want: "autogold reject: no pending snapshot for $DIR/testdata/TestB.golden\n",
+			code: 1,
+		},
+		{
+			args: []string{"accept", dir},
+			want: "accepted $DIR/testdata/TestC.golden\n",
+		},
+		{
+			args: []string{"pending", dir},
+			want: "",
+		},
+	} {
+		got, code := runCommand(t, dir, tc.args...)
+		if got != tc.want || code != tc.code {
+			t.Fatal(tc.args, "\ngot:\n", got, code, "\nwant:\n", tc.want, tc.code)
+		}
+	}
+
+	for name, want := range map[string]string{"TestA.golden": "A\n", "TestC.golden": "c\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatal("\ngot:\n", string(got), "\nwant:\n", want)
+		}
+	}
+}
+
+func TestRun_goldens(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"foo_test.go": `package foo
+
+func TestA(t *testing.T) {}
+
+func TestB(t *testing.T) {
+	autogold.ExpectFile(t, 1, autogold.Name("custom/name"))
+}
+
+func Testlowercase(t *testing.T) {}
+
+func helper() {}
+`,
+		"testdata/TestA.golden":            "a\n",
+		"testdata/TestA.2.golden.json":     "{}\n",
+		"testdata/TestA.golden.new":        "A\n",
+		"testdata/TestB/sub.golden":        "b\n",
+		"testdata/custom/name.golden":      "c\n",
+		"testdata/TestGone.golden":         "gone\n",
+		"testdata/Testlowercase.golden":    "not a test\n",
+		"testdata/input.json":              "{}\n",
+		"sub/bar_test.go":                  "package bar\n\nfunc FuzzC(f *testing.F) {}\n",
+		"sub/testdata/FuzzC/seed.golden":   "c\n",
+		"nottests/testdata/TestD.golden":   "d\n",
+		"sub/testdata/TestGone/sub.golden": "gone\n",
+	})
+
+	// Run in dir, so that the output is aligned the same way regardless of its path.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+		code int
+	}{
+		{
+			args: []string{"list"},
+			want: `testdata/TestA.2.golden.json   TestA
+testdata/TestA.golden          TestA
+testdata/TestB/sub.golden      TestB/sub
+testdata/TestGone.golden       TestGone (unused)
+testdata/Testlowercase.golden  Testlowercase (unused)
+testdata/custom/name.golden    custom/name
+`,
+		},
+		{
+			args: []string{"unused", "./..."},
+			want: "testdata/TestGone.golden\ntestdata/Testlowercase.golden\nsub/testdata/TestGone/sub.golden\n",
+			code: 1,
+		},
+		{
+			args: []string{"unused", "sub", "./sub"},
+			want: "sub/testdata/TestGone/sub.golden\n",
+			code: 1,
+		},
+		{
+			args: []string{"stats", "./..."},
+			want: `PACKAGE  TESTS  GOLDEN FILES  SIZE  UNUSED  PENDING
+.        2      6             25 B  2       1
+sub      1      2             7 B   1       0
+total    3      8             32 B  3       1
+`,
+		},
+	} {
+		got, code := runCommand(t, dir, tc.args...)
+		if got != tc.want || code != tc.code {
+			t.Fatal(tc.args, "\ngot:\n", got, code, "\nwant:\n", tc.want, tc.code)
+		}
+	}
+}
+
+func Test_formatSize(t *testing.T) {
+	for size, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 20: "5.0 MiB"} {
+		if got := formatSize(size); got != want {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+		}
+	}
+}
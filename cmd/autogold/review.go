@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hexops/autogold/v2/internal/pending"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+//go:embed review.html
+var reviewFS embed.FS
+
+var reviewTemplate = template.Must(template.ParseFS(reviewFS, "review.html"))
+
+// review serves the review UI for the pending snapshots in the given paths at addr, until the
+// server fails. If test is set, `go test -update=pending` is run for the paths first, so that
+// mismatched snapshots become pending snapshots.
+func review(stdout, stderr io.Writer, paths []string, addr string, test bool) int {
+	srv, err := newReviewServer(paths, goTestPending)
+	if err != nil {
+		fmt.Fprintf(stderr, "autogold review: %v\n", err)
+		return 1
+	}
+	if test {
+		fmt.Fprintln(stdout, "autogold: running go test -update=pending ...")
+		srv.runTests(context.Background())
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "autogold review: %v\n", err)
+		return 1
+	}
+	srv.hosts = []string{addr, ln.Addr().String()}
+	fmt.Fprintf(stdout, "autogold: reviewing pending snapshots at http://%s/\n", ln.Addr())
+	if err := http.Serve(ln, srv); err != nil {
+		fmt.Fprintf(stderr, "autogold review: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// goTestPending runs `go test -update=pending` for the packages in the given directories, returning
+// its output.
+func goTestPending(ctx context.Context, paths []string) (string, error) {
+	args := []string{"test"}
+	for _, path := range paths {
+		// Relative directories must begin with "./", as the go tool treats them as import paths
+		// otherwise.
+		if !filepath.IsAbs(path) && !strings.HasPrefix(path, ".") {
+			path = "." + string(filepath.Separator) + path
+		}
+		args = append(args, path)
+	}
+	args = append(args, "-update=pending")
+	cmd := exec.CommandContext(ctx, "go", args...)
+	out, err := cmd.CombinedOutput()
+	return fmt.Sprintf("$ go %s\n%s", strings.Join(args, " "), out), err
+}
+
+// reviewServer serves a page listing the pending snapshots in paths with side-by-side diffs, and
+// handles accepting and rejecting them.
+type reviewServer struct {
+	paths  []string
+	goTest func(ctx context.Context, paths []string) (string, error)
+
+	// token must be given with every request that modifies files, so that other websites cannot
+	// make the browser accept or reject snapshots.
+	token string
+
+	// hosts are the Host headers accepted in addition to loopback names, e.g. the address listened
+	// on. Requests for other hosts are rejected, so that other websites cannot use DNS rebinding to
+	// read the page (and token.)
+	hosts []string
+
+	mu         sync.Mutex
+	testOutput string
+	testFailed bool
+}
+
+func newReviewServer(paths []string, goTest func(ctx context.Context, paths []string) (string, error)) (*reviewServer, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	return &reviewServer{paths: paths, goTest: goTest, token: hex.EncodeToString(token)}, nil
+}
+
+// runTests runs `go test -update=pending`, recording its output to show on the page.
+func (s *reviewServer) runTests(ctx context.Context) {
+	out, err := s.goTest(ctx, s.paths)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.testOutput, s.testFailed = out, err != nil
+	if err != nil {
+		s.testOutput += err.Error() + "\n"
+	}
+}
+
+func (s *reviewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackAddr(r.RemoteAddr) {
+		http.Error(w, "the review server only accepts requests from this machine", http.StatusForbidden)
+		return
+	}
+	if !s.allowedHost(r.Host) {
+		http.Error(w, "invalid host "+r.Host, http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case "/":
+		s.serveIndex(w, r)
+	case "/file":
+		s.serveFile(w, r)
+	case "/accept", "/reject", "/test":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.FormValue("token") != s.token {
+			http.Error(w, "invalid token, reload the page", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/test" {
+			s.runTests(r.Context())
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		s.serveAcceptReject(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allowedHost reports whether a request for host (the Host header, e.g. "localhost:8080") is
+// allowed: it must be a loopback name or address, or one of s.hosts.
+func (s *reviewServer) allowedHost(host string) bool {
+	for _, h := range s.hosts {
+		if host == h {
+			return true
+		}
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	switch strings.Trim(name, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// isLoopbackAddr reports whether addr (the remote address of a request, e.g. "127.0.0.1:51234") is
+// a loopback address. As the Host header is chosen by the client, it is only checked to prevent DNS
+// rebinding, and requests from other machines are rejected even if the server listens on them
+// (e.g. using `-addr :8080`).
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// reviewItem is a pending snapshot shown on the page.
+type reviewItem struct {
+	Path, Target, Kind string
+	New                bool
+	Files              []reviewFile
+	Error              string
+}
+
+// reviewFile is a changed file of a pending snapshot shown on the page.
+type reviewFile struct {
+	Name string
+
+	// Rows is the side-by-side diff of text files.
+	Rows []diffRow
+
+	// Binary describes changes to binary files, which are not diffed.
+	Binary string
+
+	// WantURL and GotURL are the URLs of the old and new images, for image previews.
+	WantURL, GotURL string
+}
+
+func (s *reviewServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshots, err := resolve(s.paths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]reviewItem, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		items = append(items, newReviewItem(snapshot))
+	}
+
+	s.mu.Lock()
+	data := struct {
+		Paths      string
+		Token      string
+		Items      []reviewItem
+		TestOutput string
+		TestFailed bool
+		Message    string
+	}{
+		Paths:      strings.Join(s.paths, " "),
+		Token:      s.token,
+		Items:      items,
+		TestOutput: s.testOutput,
+		TestFailed: s.testFailed,
+		Message:    r.URL.Query().Get("message"),
+	}
+	s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := reviewTemplate.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func newReviewItem(s pending.Snapshot) reviewItem {
+	item := reviewItem{Path: s.Path, Target: s.Target, Kind: s.Kind.String()}
+	if _, err := os.Stat(s.Target); os.IsNotExist(err) {
+		item.New = true
+	}
+	changes, err := s.Changes()
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	for _, c := range changes {
+		file := reviewFile{Name: c.Name}
+		switch {
+		case strings.HasSuffix(c.Name, ".png"):
+			gotPath := s.Path
+			if s.Kind == pending.Dir {
+				rel, _ := filepath.Rel(s.Target, c.Name)
+				gotPath = filepath.Join(s.Path, rel)
+			}
+			if c.Want != nil {
+				file.WantURL = "/file?" + url.Values{"path": {c.Name}}.Encode()
+			}
+			if c.Got != nil {
+				file.GotURL = "/file?" + url.Values{"path": {gotPath}}.Encode()
+			}
+		case !utf8.Valid(c.Want) || !utf8.Valid(c.Got):
+			file.Binary = fmt.Sprintf("binary file changed (%d bytes → %d bytes)", len(c.Want), len(c.Got))
+		default:
+			file.Rows = sideBySide(string(c.Want), string(c.Got))
+		}
+		item.Files = append(item.Files, file)
+	}
+	return item
+}
+
+// serveFile serves a file of a pending snapshot, or the file it changes, for image previews.
+func (s *reviewServer) serveFile(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Clean(r.URL.Query().Get("path"))
+	snapshots, err := resolve(s.paths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, snapshot := range snapshots {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && snapshotContains(snapshot, path) {
+			w.Header().Set("Cache-Control", "no-store")
+			http.ServeFile(w, r, path)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// snapshotContains reports whether path is the pending snapshot or the file it changes, or a file
+// within them for golden directories.
+func snapshotContains(s pending.Snapshot, path string) bool {
+	if path == s.Path || path == s.Target {
+		return true
+	}
+	if s.Kind != pending.Dir {
+		return false
+	}
+	for _, dir := range []string{s.Path, s.Target} {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *reviewServer) serveAcceptReject(w http.ResponseWriter, r *http.Request) {
+	accept := r.URL.Path == "/accept"
+	snapshots, err := resolve(s.paths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("all") == "" {
+		path := r.FormValue("path")
+		var selected []pending.Snapshot
+		for _, snapshot := range snapshots {
+			if snapshot.Path == path {
+				selected = append(selected, snapshot)
+			}
+		}
+		if len(selected) == 0 {
+			http.Error(w, "no pending snapshot "+path, http.StatusNotFound)
+			return
+		}
+		snapshots = selected
+	}
+
+	var messages []string
+	for _, snapshot := range snapshots {
+		var err error
+		if accept {
+			err = snapshot.Accept()
+		} else {
+			err = snapshot.Reject()
+		}
+		switch {
+		case err != nil:
+			messages = append(messages, err.Error())
+		case accept:
+			messages = append(messages, "accepted "+snapshot.Target)
+		default:
+			messages = append(messages, "rejected "+snapshot.Target)
+		}
+	}
+	http.Redirect(w, r, "/?"+url.Values{"message": {strings.Join(messages, "\n")}}.Encode(), http.StatusSeeOther)
+}
+
+// diffRow is a row of a side-by-side diff: a line of the old file on the left, and of the new file
+// on the right. Either side may be empty, if a line was added or removed.
+type diffRow struct {
+	// Hunk is set for the header row of a hunk, e.g. "@@ -1,4 +1,5 @@".
+	Hunk string
+
+	OldLine, NewLine int // 1-based, or 0 if there is no line on that side
+	Old, New         string
+	OldKind, NewKind string // "equal", "delete", "insert" or "" if there is no line on that side
+}
+
+// sideBySide returns a side-by-side diff of the old and new contents, with changed lines paired up
+// and unchanged lines around them for context.
+func sideBySide(old, new string) []diffRow {
+	edits := myers.ComputeEdits(span.URIFromPath("old"), old, new)
+	unified := gotextdiff.ToUnified("old", "new", old, edits)
+	var rows []diffRow
+	for _, hunk := range unified.Hunks {
+		rows = append(rows, diffRow{Hunk: hunkHeader(hunk)})
+		oldLine, newLine := hunk.FromLine, hunk.ToLine
+		var deleted, inserted []string
+		flush := func() {
+			for i := 0; i < len(deleted) || i < len(inserted); i++ {
+				var row diffRow
+				if i < len(deleted) {
+					row.OldLine, row.Old, row.OldKind = oldLine, deleted[i], "delete"
+					oldLine++
+				}
+				if i < len(inserted) {
+					row.NewLine, row.New, row.NewKind = newLine, inserted[i], "insert"
+					newLine++
+				}
+				rows = append(rows, row)
+			}
+			deleted, inserted = nil, nil
+		}
+		for _, line := range hunk.Lines {
+			content := strings.TrimSuffix(line.Content, "\n")
+			switch line.Kind {
+			case gotextdiff.Delete:
+				deleted = append(deleted, content)
+			case gotextdiff.Insert:
+				inserted = append(inserted, content)
+			default:
+				flush()
+				rows = append(rows, diffRow{OldLine: oldLine, NewLine: newLine, Old: content, New: content, OldKind: "equal", NewKind: "equal"})
+				oldLine++
+				newLine++
+			}
+		}
+		flush()
+	}
+	return rows
+}
+
+// hunkHeader returns the header of a hunk as in a unified diff, e.g. "@@ -1,4 +1,5 @@".
+func hunkHeader(hunk *gotextdiff.Hunk) string {
+	fromCount, toCount := 0, 0
+	for _, line := range hunk.Lines {
+		switch line.Kind {
+		case gotextdiff.Delete:
+			fromCount++
+		case gotextdiff.Insert:
+			toCount++
+		default:
+			fromCount++
+			toCount++
+		}
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", hunk.FromLine, fromCount, hunk.ToLine, toCount)
+}
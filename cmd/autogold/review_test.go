@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func TestReviewServer(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"testdata/TestA.golden":           "a\nb\n",
+		"testdata/TestA.golden.new":       "a\nc\n",
+		"testdata/TestB.golden.new":       "<b>\n",
+		"testdata/TestImg.golden.png":     "\x89PNG old",
+		"testdata/TestImg.golden.png.new": "\x89PNG new",
+		"testdata/secret.txt":             "secret",
+	})
+	var ran []string
+	srv, err := newReviewServer([]string{dir}, func(ctx context.Context, paths []string) (string, error) {
+		ran = append(ran, paths...)
+		return "FAIL\n", errors.New("exit status 1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	get := func(path string) (int, string) {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	post := func(path string, form url.Values) (int, string) {
+		resp, err := client.PostForm(ts.URL+path, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+	golden := func(name string) string { return filepath.Join(dir, "testdata", name) }
+
+	code, page := get("/")
+	if code != http.StatusOK {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusOK)
+	}
+	for _, want := range []string{
+		golden("TestA.golden"),
+		`<td class="old delete">b</td>`,
+		`<td class="insert">c</td>`,
+		`<td class="insert">&lt;b&gt;</td>`,
+		`<span class="badge new">new</span>`,
+		`<img src="/file?path=` + url.QueryEscape(golden("TestImg.golden.png")) + `"`,
+		`<img src="/file?path=` + url.QueryEscape(golden("TestImg.golden.png.new")) + `"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatal("expected page to contain", want, "\ngot:\n", page)
+		}
+	}
+
+	// Only files of pending snapshots are served.
+	if code, body := get("/file?path=" + url.QueryEscape(golden("TestImg.golden.png.new"))); code != http.StatusOK || body != "\x89PNG new" {
+		t.Fatal("\ngot:\n", code, body)
+	}
+	if code, _ := get("/file?path=" + url.QueryEscape(golden("secret.txt"))); code != http.StatusNotFound {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusNotFound)
+	}
+
+	// Requests for other hosts (e.g. by DNS rebinding) are rejected.
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = net.JoinHostPort("attacker.example", port)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatal("\ngot:\n", resp.StatusCode, "\nwant:\n", http.StatusForbidden)
+	}
+
+	// Requests from other machines are rejected, even for a loopback host.
+	rec := httptest.NewRecorder()
+	remote := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	remote.RemoteAddr = "192.0.2.1:51234"
+	srv.ServeHTTP(rec, remote)
+	if rec.Code != http.StatusForbidden {
+		t.Fatal("\ngot:\n", rec.Code, "\nwant:\n", http.StatusForbidden)
+	}
+
+	// Changes require the token.
+	if code, _ := post("/accept", url.Values{"path": {golden("TestA.golden.new")}}); code != http.StatusForbidden {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusForbidden)
+	}
+	if code, _ := get("/accept?token=" + srv.token); code != http.StatusMethodNotAllowed {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusMethodNotAllowed)
+	}
+
+	code, location := post("/accept", url.Values{"token": {srv.token}, "path": {golden("TestA.golden.new")}})
+	if code != http.StatusSeeOther || !strings.Contains(location, url.QueryEscape("accepted "+golden("TestA.golden"))) {
+		t.Fatal("\ngot:\n", code, location)
+	}
+	if got, _ := os.ReadFile(golden("TestA.golden")); string(got) != "a\nc\n" {
+		t.Fatal("\ngot:\n", string(got), "\nwant:\n", "a\nc\n")
+	}
+	if code, _ := post("/reject", url.Values{"token": {srv.token}, "all": {"1"}}); code != http.StatusSeeOther {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusSeeOther)
+	}
+	if got, _ := os.ReadFile(golden("TestImg.golden.png")); string(got) != "\x89PNG old" {
+		t.Fatal("\ngot:\n", string(got), "\nwant:\n", "\x89PNG old")
+	}
+	if snapshots, _ := resolve([]string{dir}); len(snapshots) != 0 {
+		t.Fatal("expected no pending snapshots, got", snapshots)
+	}
+
+	if code, _ := post("/test", url.Values{"token": {srv.token}}); code != http.StatusSeeOther {
+		t.Fatal("\ngot:\n", code, "\nwant:\n", http.StatusSeeOther)
+	}
+	if !reflect.DeepEqual(ran, []string{dir}) {
+		t.Fatal("\ngot:\n", ran, "\nwant:\n", []string{dir})
+	}
+	_, page = get("/")
+	for _, want := range []string{"Tests failed", "exit status 1", "No pending snapshots"} {
+		if !strings.Contains(page, want) {
+			t.Fatal("expected page to contain", want, "\ngot:\n", page)
+		}
+	}
+}
+
+func Test_sideBySide(t *testing.T) {
+	got := sideBySide("a\nb\nc\nd\n", "a\nB\nC\nX\nd\n")
+	want := []diffRow{
+		{Hunk: "@@ -1,4 +1,5 @@"},
+		{OldLine: 1, NewLine: 1, Old: "a", New: "a", OldKind: "equal", NewKind: "equal"},
+		{OldLine: 2, NewLine: 2, Old: "b", New: "B", OldKind: "delete", NewKind: "insert"},
+		{OldLine: 3, NewLine: 3, Old: "c", New: "C", OldKind: "delete", NewKind: "insert"},
+		{NewLine: 4, New: "X", NewKind: "insert"},
+		{OldLine: 4, NewLine: 5, Old: "d", New: "d", OldKind: "equal", NewKind: "equal"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func Test_allowedHost(t *testing.T) {
+	s := &reviewServer{hosts: []string{"devbox:8080"}}
+	for host, want := range map[string]bool{
+		"localhost:1234":     true,
+		"localhost":          true,
+		"127.0.0.1:1234":     true,
+		"[::1]:1234":         true,
+		"devbox:8080":        true,
+		"devbox:9090":        false,
+		"attacker.example":   false,
+		"localhost.evil.com": false,
+		"":                   false,
+	} {
+		if got := s.allowedHost(host); got != want {
+			t.Fatal(host, "\ngot:\n", got, "\nwant:\n", want)
+		}
+	}
+}
+
+func Test_isLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:51234":   true,
+		"127.0.0.2:51234":   true,
+		"[::1]:51234":       true,
+		"192.168.1.5:51234": false,
+		"[fe80::1]:51234":   false,
+		"localhost:51234":   false,
+		"127.0.0.1":         false,
+		"":                  false,
+	} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Fatal(addr, "\ngot:\n", got, "\nwant:\n", want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package autogold
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
@@ -10,8 +11,30 @@ import (
 )
 
 func diff(got, want string, opts []Option) string {
+	if semanticJSON(opts) {
+		if diff, ok := jsonDiff(got, want); ok {
+			return diff
+		}
+	}
+	format := fileFormat(opts)
+	switch format {
+	case Binary:
+		return hexDiff(got, want)
+	case JSON, YAML:
+		// Report changed values by their path, e.g. "$.items[3].price: 10 -> 12". If the documents
+		// only differ in formatting (e.g. a hand-edited golden file), fall back to a text diff.
+		if diff, ok := structuredDiff(got, want, format); ok && diff != "" {
+			return diff
+		}
+	}
+	wantName, gotName := "want", "got"
+	if format != GoSyntax {
+		// Name the files by their format, e.g. "want.json", so the diff reads as that format.
+		ext := strings.TrimPrefix(format.extension(), ".golden")
+		wantName, gotName = wantName+ext, gotName+ext
+	}
 	edits := myers.ComputeEdits(span.URIFromPath("out"), string(want), got)
-	return fmt.Sprint(gotextdiff.ToUnified("want", "got", string(want), edits))
+	return fmt.Sprint(gotextdiff.ToUnified(wantName, gotName, string(want), edits))
 }
 
 // Raw denotes a raw string.
@@ -46,6 +69,8 @@ func stringify(v interface{}, opts []Option) string {
 	if v, ok := v.(Raw); ok && allowRaw {
 		return string(v)
 	}
+	v = sortSlices(v, opts)
+	v = stripProtoInternals(v)
 	s := valast.StringWithOptions(v, valastOpt)
 	if trailingNewline {
 		return s + "\n"
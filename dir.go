@@ -0,0 +1,238 @@
+package autogold
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hexops/autogold/v2/internal/pending"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+// ExpectDir checks if the files in dir are equal to those in the saved `testdata/<test name>/`
+// directory, recursively. If they are not, the test is failed and the added, removed and changed
+// files are reported along with a diff for each.
+//
+// If the `go test -update` flag is specified, the golden directory will be updated to exactly match
+// dir (including removing files which no longer exist in dir) and the test will not fail unless
+// `-fail-on-update` is specified. With `-update=pending`, the proposed golden directory is written
+// to `testdata/<test name>.new/` instead.
+//
+// The golden directory is owned entirely by ExpectDir, so golden files of subtests (which are also
+// written to `testdata/<test name>/`) must not be placed there; use the Name option to pick a
+// different name if needed.
+func ExpectDir(t *testing.T, dir string, opts ...Option) {
+	goldenDir := goldenPath(t, opts, "")
+
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := goldenStore(opts)
+	if _, isOS := baseStore(store).(osStore); isOS {
+		recordCleanupTree(t, goldenDir)
+	}
+	unlock, err := store.Lock(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	want, err := readDirFiles(store, goldenDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+
+	changes := compareFiles(want, got, opts)
+	if pendingUpdate() {
+		// Replace the proposed golden directory of a previous run, or remove it if the golden
+		// directory now matches.
+		pendingDir := pending.Path(goldenDir)
+		proposed, err := readDirFiles(store, pendingDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+		if len(changes) == 0 && len(proposed) > 0 {
+			if err := syncDirFiles(store, pendingDir, proposed, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Remove(pendingDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.Fatal(err)
+			}
+		} else if len(changes) > 0 {
+			if err := syncDirFiles(store, pendingDir, proposed, got); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if update() && !pendingUpdate() {
+		if err := syncDirFiles(store, goldenDir, want, got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *failOnUpdate || !update() {
+		t.Log(fmt.Errorf("directory mismatch (-want +got):\n%s", colorDiff(changes.String())))
+		t.FailNow()
+	}
+}
+
+// readDirFiles reads all files in dir in the store recursively, returning their contents keyed by
+// slash-separated path relative to dir.
+func readDirFiles(store Store, dir string) (map[string]string, error) {
+	names, err := store.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := store.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+	}
+	return files, nil
+}
+
+// syncDirFiles updates dir in the store, which currently contains the files old, to contain exactly
+// the files new. Directories left empty are removed.
+func syncDirFiles(store Store, dir string, old, new map[string]string) error {
+	for name, data := range new {
+		if oldData, ok := old[name]; ok && oldData == data {
+			continue
+		}
+		if err := store.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data)); err != nil {
+			return err
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; ok {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := store.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if pruner, ok := store.(dirPruner); ok {
+			if err := pruner.pruneEmptyDirs(dir, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileMismatch describes a difference between a golden file and the file a test produced.
+type fileMismatch struct {
+	name string
+	kind string // "added", "removed" or "changed"
+	diff string
+}
+
+type fileMismatches []fileMismatch
+
+// String returns a summary of the changes, followed by a diff for each.
+func (c fileMismatches) String() string {
+	var b strings.Builder
+	for _, change := range c {
+		fmt.Fprintf(&b, "%s: %s\n", change.kind, change.name)
+	}
+	for _, change := range c {
+		b.WriteString("\n")
+		b.WriteString(change.diff)
+	}
+	return b.String()
+}
+
+// compareFiles compares sets of named files, returning the changes sorted by file name.
+func compareFiles(want, got map[string]string, opts []Option) fileMismatches {
+	names := make([]string, 0, len(want)+len(got))
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes fileMismatches
+	for _, name := range names {
+		wantData, inWant := want[name]
+		gotData, inGot := got[name]
+		kind := "changed"
+		switch {
+		case !inWant:
+			kind = "added"
+		case !inGot:
+			kind = "removed"
+		case wantData == gotData:
+			continue
+		}
+		changes = append(changes, fileMismatch{
+			name: name,
+			kind: kind,
+			diff: fileDiff(name, gotData, wantData, opts),
+		})
+	}
+	return changes
+}
+
+// fileDiff returns a diff of a single named file, using a hex dump diff for binary content.
+func fileDiff(name, got, want string, opts []Option) string {
+	if !isText(got) || !isText(want) {
+		return "binary file " + name + " differs\n" + hexDiff(got, want)
+	}
+	if semanticJSON(opts) {
+		if diff, ok := jsonDiff(got, want); ok {
+			return "--- want/" + name + "\n+++ got/" + name + "\n" + diff
+		}
+	}
+	// gotextdiff does not handle diffing against an empty file well, so do it ourselves.
+	if got == "" && want != "" {
+		lines := splitLines(want)
+		return fmt.Sprintf("--- want/%s\n+++ got/%s\n@@ -1,%d +0,0 @@\n-%s", name, name, len(lines), strings.Join(lines, "-"))
+	}
+	if want == "" && got != "" {
+		lines := splitLines(got)
+		return fmt.Sprintf("--- want/%s\n+++ got/%s\n@@ -0,0 +1,%d @@\n+%s", name, name, len(lines), strings.Join(lines, "+"))
+	}
+	edits := myers.ComputeEdits(span.URIFromPath(name), want, got)
+	return fmt.Sprint(gotextdiff.ToUnified("want/"+name, "got/"+name, want, edits))
+}
+
+// splitLines splits s into lines, each ending in a newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n"
+	}
+	return lines
+}
+
+// isText reports whether s looks like text rather than binary data.
+func isText(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsRune(s, 0)
+}
@@ -0,0 +1,80 @@
+package autogold
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func TestExpectDir(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"main.go":          "package main\n",
+		"config/app.yaml":  "name: app\n",
+		"assets/logo.bin":  "\x00\x01\x02",
+		"assets/README.md": "# Assets\n",
+	})
+	ExpectDir(t, dir)
+}
+
+func Test_compareFiles(t *testing.T) {
+	want := map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "a\nb\n",
+		"removed.txt": "gone\n",
+	}
+	got := map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "a\nc\n",
+		"added.txt":   "new\n",
+	}
+	changes := compareFiles(want, got, nil)
+	want2 := `added: added.txt
+changed: changed.txt
+removed: removed.txt
+
+--- want/added.txt
++++ got/added.txt
+@@ -0,0 +1,1 @@
++new
+
+--- want/changed.txt
++++ got/changed.txt
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+
+--- want/removed.txt
++++ got/removed.txt
+@@ -1,1 +0,0 @@
+-gone
+`
+	if got := changes.String(); got != want2 {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want2)
+	}
+}
+
+func Test_syncDirFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := map[string]string{"keep.txt": "keep", "a/b/remove.txt": "remove", "a/change.txt": "old"}
+	testutil.WriteFiles(t, dir, old)
+
+	new := map[string]string{"keep.txt": "keep", "a/change.txt": "new", "c/add.txt": "add"}
+	if err := syncDirFiles(OSStore(), dir, old, new); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, new) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", new)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "b")); !os.IsNotExist(err) {
+		t.Fatal("expected empty directory to be removed, got", err)
+	}
+}
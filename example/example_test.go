@@ -1,11 +1,18 @@
 package example
 
 import (
+	"os"
 	"testing"
 
 	"github.com/hexops/autogold/v2"
 )
 
+// TestMain runs the tests via autogold.Run, so that `go test -update -clean` removes unused golden
+// files.
+func TestMain(m *testing.M) {
+	os.Exit(autogold.Run(m))
+}
+
 func TestExpectFile(t *testing.T) {
 	got := Bar()
 	autogold.ExpectFile(t, got)
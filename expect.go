@@ -17,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hexops/autogold/v2/internal/pending"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/imports"
@@ -89,7 +90,9 @@ find:
 //
 // When `-update` is specified, autogold will find and replace in the test file by looking for an
 // invocation of `autogold.Expect(...)` at the same line as the callstack indicates for this function
-// call, rewriting the `want` value parameter for you.
+// call, rewriting the `want` value parameter for you. With `-update=pending`, the test file is left
+// as-is and the changes are written to a patch file next to it (`<file>_test.go.autogold.patch`)
+// instead, for review with the autogold command.
 func Expect(want interface{}) Value {
 	_, _, line, _ := runtime.Caller(1)
 	return value{
@@ -120,6 +123,18 @@ func Expect(want interface{}) Value {
 				fmt.Println("  rewrite autogold.Expect:", profReplaceExpect)
 			}
 
+			// Proposed changes from a previous `-update=pending` run are replaced by this one, and so
+			// must be discarded even if this call passes.
+			if pendingUpdate() {
+				file, ok := callerTestFile()
+				if !ok {
+					t.Fatal("runtime.Caller: returned ok=false")
+				}
+				if err := discardStalePatch(file); err != nil {
+					t.Fatal(fmt.Errorf("autogold: %v", err))
+				}
+			}
+
 			// Fast-path: check if the test passed via reflect.DeepEqual to avoid
 			// slower stringify. This relies on reflect.DeepEqual => stringify
 			// equal. Note that stringify equal =/=> reflect.DeepEqual but that is
@@ -140,16 +155,7 @@ func Expect(want interface{}) Value {
 			}
 
 			// Find the path to the calling _test.go, relative to where the test is being run.
-			var (
-				file string
-				ok   bool
-			)
-			for caller := 1; ; caller++ {
-				_, file, _, ok = runtime.Caller(caller)
-				if !ok || strings.Contains(file, "_test.go") {
-					break
-				}
-			}
+			file, ok := callerTestFile()
 			if !ok {
 				t.Fatal("runtime.Caller: returned ok=false")
 			}
@@ -223,6 +229,19 @@ func Expect(want interface{}) Value {
 	}
 }
 
+// callerTestFile returns the path of the nearest _test.go file in the callstack.
+func callerTestFile() (string, bool) {
+	for caller := 1; ; caller++ {
+		_, file, _, ok := runtime.Caller(caller)
+		if !ok {
+			return "", false
+		}
+		if strings.Contains(file, "_test.go") {
+			return file, true
+		}
+	}
+}
+
 type fileChanges struct {
 	before []byte
 	now    []byte
@@ -300,6 +319,10 @@ func replaceExpect(t *testing.T, testFilePath, testName string, line int, replac
 		changes = &fileChanges{before: testFileSrc}
 		changesByFile[testFilePath] = changes
 	}
+	if pendingUpdate() && changes.now != nil {
+		// The test file is left as-is, so build on the changes proposed so far.
+		testFileSrc = changes.now
+	}
 
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, testFilePath, testFileSrc, parser.ParseComments)
@@ -347,18 +370,60 @@ func replaceExpect(t *testing.T, testFilePath, testName string, line int, replac
 
 	changes.update(newFile)
 
-	if writeFile {
-		info, err := os.Stat(testFilePath)
-		if err != nil {
+	if writeFile && pendingUpdate() {
+		if err := writeExpectPatch(testFilePath, changes); err != nil {
 			return nil, err
 		}
-		if err := ioutil.WriteFile(testFilePath, []byte(newFile), info.Mode()); err != nil {
+	} else if writeFile {
+		if err := writeFileAtomic(testFilePath, []byte(newFile), 0o666); err != nil {
 			return nil, err
 		}
 	}
 	return newFile, nil
 }
 
+var (
+	stalePatchesMu sync.Mutex
+	stalePatches   = map[string]bool{}
+)
+
+// discardStalePatch removes the patch file written for the test file by a previous
+// `-update=pending` run, the first time it is called for the test file, so that it is replaced by
+// the changes proposed by this run (if any.)
+func discardStalePatch(testFilePath string) error {
+	stalePatchesMu.Lock()
+	defer stalePatchesMu.Unlock()
+	if stalePatches[testFilePath] {
+		return nil
+	}
+	stalePatches[testFilePath] = true
+
+	unlock, err := acquirePathLock(testFilePath)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(pending.PatchPath(testFilePath))
+	if unlockErr := unlock(); err == nil || os.IsNotExist(err) {
+		err = unlockErr
+	}
+	return err
+}
+
+// writeExpectPatch writes the changes made to the test file so far as a patch file next to it (see
+// pending.PatchPath), for `-update=pending`. The patch is relative to the test file's directory.
+func writeExpectPatch(testFilePath string, changes *fileChanges) error {
+	patchPath := pending.PatchPath(testFilePath)
+	name := filepath.Base(testFilePath)
+	patch := pending.Unified(name, name, string(changes.before), string(changes.now))
+	if patch == "" {
+		if err := os.Remove(patchPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(patchPath, []byte(patch), 0o666)
+}
+
 func findExpectCallExpr(fset *token.FileSet, f *ast.File, testName string, line int) (*ast.CallExpr, error) {
 	var foundCallExpr *ast.CallExpr
 	pre := func(cursor *astutil.Cursor) bool {
@@ -254,6 +254,13 @@ func testEqualSubtestSameNames(t *testing.T) {
 	}
 }
 
+func TestExpectFile_multipleCalls(t *testing.T) {
+	ExpectFile(t, "first")
+	ExpectFile(t, "second")
+	ExpectFile(t, "third", Format(Text))
+	ExpectFile(t, "fourth", Format(Text))
+}
+
 func Benchmark_getPackageNameAndPath_cached(b *testing.B) {
 	// Wipe the cache, as it was populated by other tests.
 	getPackageNameAndPathCacheMu.Lock()
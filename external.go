@@ -0,0 +1,212 @@
+package autogold
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BlobStore is a content-addressed store for the contents of large golden files, see ExternalBlobs.
+// Blobs are identified by the hex-encoded SHA-256 hash of their contents.
+type BlobStore interface {
+	// Get returns the contents of the blob with the given hash. If the blob does not exist, the
+	// returned error satisfies errors.Is(err, fs.ErrNotExist).
+	Get(hash string) ([]byte, error)
+
+	// Put stores data as the blob with the given hash.
+	Put(hash string, data []byte) error
+}
+
+// ExternalBlobs specifies that golden files should store only a small pointer file (containing the
+// hash and size of their contents), with the contents themselves stored in blobs. This keeps large
+// golden files out of the source repository.
+//
+// The contents are fetched and verified against the pointer file when comparing, and stored in
+// blobs when golden files are written using `-update`. Existing golden files which are not pointer
+// files are read as-is, and replaced with pointer files when next updated. If the blob of a golden
+// file is missing or corrupt, the test fails unless `-update` is specified, which regenerates it.
+// Blobs are never removed by autogold, not even by -clean.
+func ExternalBlobs(blobs BlobStore) Option {
+	return &option{blobs: blobs}
+}
+
+// blobPointerHeader is the first line of golden pointer files.
+const blobPointerHeader = "autogold blob v1"
+
+// blobPointer describes the contents of a golden file stored externally.
+type blobPointer struct {
+	hash string
+	size int64
+}
+
+func (p blobPointer) String() string {
+	return fmt.Sprintf("%s\nsha256 %s\nsize %d\n", blobPointerHeader, p.hash, p.size)
+}
+
+// parseBlobPointer parses a pointer file, returning ok=false if data is not a pointer file.
+func parseBlobPointer(data []byte) (p blobPointer, ok bool) {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 4 || lines[0] != blobPointerHeader || lines[3] != "" {
+		return p, false
+	}
+	hash, ok := strings.CutPrefix(lines[1], "sha256 ")
+	if !ok || !isBlobHash(hash) {
+		return p, false
+	}
+	size, ok := strings.CutPrefix(lines[2], "size ")
+	if !ok {
+		return p, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return p, false
+	}
+	return blobPointer{hash: hash, size: n}, true
+}
+
+// isBlobHash reports whether hash is a hex-encoded SHA-256 hash, as written by externalStore. This
+// ensures hashes read from pointer files are safe to use in file paths and URLs.
+func isBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// brokenBlobError is returned when reading a pointer file whose blob is missing or corrupt. Under
+// `-update`, such golden files are treated as missing so that they can be regenerated.
+type brokenBlobError struct {
+	hash, name string
+	problem    string // e.g. "does not exist"
+}
+
+func (e *brokenBlobError) Error() string {
+	return fmt.Sprintf("autogold: blob %s referenced by %s %s", e.hash, e.name, e.problem)
+}
+
+// externalStore is a Store which stores pointer files in the underlying store, and their contents
+// in blobs.
+type externalStore struct {
+	Store
+	blobs BlobStore
+}
+
+func (s externalStore) ReadFile(name string) ([]byte, error) {
+	data, err := s.Store.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := parseBlobPointer(data)
+	if !ok {
+		return data, nil
+	}
+	blob, err := s.blobs.Get(p.hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		// The pointer file exists, so this is not the same as the golden file not existing.
+		return nil, &brokenBlobError{hash: p.hash, name: name, problem: "does not exist"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("autogold: fetching blob %s referenced by %s: %w", p.hash, name, err)
+	}
+	if int64(len(blob)) != p.size || fmt.Sprintf("%x", sha256.Sum256(blob)) != p.hash {
+		return nil, &brokenBlobError{hash: p.hash, name: name, problem: "is corrupt"}
+	}
+	return blob, nil
+}
+
+func (s externalStore) WriteFile(name string, data []byte) error {
+	p := blobPointer{hash: fmt.Sprintf("%x", sha256.Sum256(data)), size: int64(len(data))}
+	if err := s.blobs.Put(p.hash, data); err != nil {
+		return fmt.Errorf("autogold: storing blob %s for %s: %w", p.hash, name, err)
+	}
+	return s.Store.WriteFile(name, []byte(p.String()))
+}
+
+// BlobDir returns a blob store which stores blobs as files in dir, e.g. a directory shared by
+// several checkouts or synchronized by other means. Blobs are stored in subdirectories named after
+// the first two characters of their hash.
+func BlobDir(dir string) BlobStore {
+	return blobDir(dir)
+}
+
+type blobDir string
+
+func (d blobDir) path(hash string) string {
+	return filepath.Join(string(d), hash[:2], hash)
+}
+
+func (d blobDir) Get(hash string) ([]byte, error) {
+	return os.ReadFile(d.path(hash))
+}
+
+func (d blobDir) Put(hash string, data []byte) error {
+	path := d.path(hash)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0o666)
+}
+
+// BlobServer returns a blob store which fetches blobs from an HTTP server using `GET <url>/<hash>`
+// and uploads them using `PUT <url>/<hash>`. A 404 Not Found response indicates the blob does not
+// exist.
+//
+// If client is nil, http.DefaultClient is used.
+func BlobServer(url string, client *http.Client) BlobStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &blobServer{url: strings.TrimSuffix(url, "/"), client: client}
+}
+
+type blobServer struct {
+	url    string
+	client *http.Client
+}
+
+func (s *blobServer) Get(hash string) ([]byte, error) {
+	resp, err := s.client.Get(s.url + "/" + hash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: "get", Path: s.url + "/" + hash, Err: fs.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s/%s: %s", s.url, hash, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *blobServer) Put(hash string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.url+"/"+hash, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT %s/%s: %s", s.url, hash, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package autogold
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestBlobServer returns an in-memory stand-in for an HTTP blob server.
+func newTestBlobServer(t *testing.T) *httptest.Server {
+	var (
+		mu    sync.Mutex
+		blobs = map[string][]byte{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hash := strings.TrimPrefix(r.URL.Path, "/blobs/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := blobs[hash]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			blobs[hash] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExternalBlobs(t *testing.T) {
+	blobDir := t.TempDir()
+	srv := newTestBlobServer(t)
+	for name, blobs := range map[string]BlobStore{
+		"dir":    BlobDir(blobDir),
+		"server": BlobServer(srv.URL+"/blobs/", nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMemStore()
+			external := goldenStore([]Option{Storage(store), ExternalBlobs(blobs)})
+			path := filepath.Join("testdata", "TestExternalBlobs", name+".golden")
+			if err := external.WriteFile(path, []byte("\"large value\"\n")); err != nil {
+				t.Fatal(err)
+			}
+			ExpectFile(t, "large value", Storage(store), ExternalBlobs(blobs))
+
+			pointer, err := store.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "autogold blob v1\nsha256 a943a3b5b8fb0f0646b2df03c3693a36de9ed956a838c57054f69bfe84eed4ac\nsize 14\n"
+			if string(pointer) != want {
+				t.Fatal("\ngot:\n", string(pointer), "\nwant:\n", want)
+			}
+		})
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		store := NewMemStore()
+		if err := store.WriteFile(filepath.Join("testdata", "TestExternalBlobs", "plain.golden"), []byte("\"not a pointer\"\n")); err != nil {
+			t.Fatal(err)
+		}
+		ExpectFile(t, "not a pointer", Storage(store), ExternalBlobs(BlobDir(t.TempDir())))
+	})
+}
+
+func TestExternalBlobs_errors(t *testing.T) {
+	blobDir := t.TempDir()
+	store := goldenStore([]Option{Storage(NewMemStore()), ExternalBlobs(BlobDir(blobDir))})
+	if err := store.WriteFile("golden", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	if err := os.WriteFile(filepath.Join(blobDir, hash[:2], hash), []byte("date"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	_, err := store.ReadFile("golden")
+	want := "autogold: blob " + hash + " referenced by golden is corrupt"
+	if err == nil || err.Error() != want {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", want)
+	}
+
+	if err := os.Remove(filepath.Join(blobDir, hash[:2], hash)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.ReadFile("golden")
+	want = "autogold: blob " + hash + " referenced by golden does not exist"
+	if err == nil || err.Error() != want {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", want)
+	}
+
+	srv := newTestBlobServer(t)
+	if _, err := BlobServer(srv.URL+"/blobs", nil).Get(hash); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", fs.ErrNotExist)
+	}
+}
+
+func TestExternalBlobs_updateBroken(t *testing.T) {
+	setUpdateFlag(t, "true")
+	blobDir := t.TempDir()
+	store := NewMemStore()
+	path := filepath.Join("testdata", "TestExternalBlobs_updateBroken.golden")
+	hash := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	if err := store.WriteFile(path, []byte(blobPointer{hash: hash, size: 4}.String())); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(blobDir, hash[:2]), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(blobDir, hash[:2], hash), []byte("date"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The golden file is regenerated, rather than failing because its blob is corrupt.
+	ExpectFile(t, Raw("data"), Storage(store), ExternalBlobs(BlobDir(blobDir)))
+	got, err := goldenStore([]Option{Storage(store), ExternalBlobs(BlobDir(blobDir))}).ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "data" {
+		t.Fatal("\ngot:\n", string(got), "\nwant:\n", "data")
+	}
+}
+
+func Test_parseBlobPointer(t *testing.T) {
+	hash := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	if p, ok := parseBlobPointer([]byte(blobPointer{hash: hash, size: 4}.String())); !ok || p.hash != hash || p.size != 4 {
+		t.Fatal("\ngot:\n", p, ok)
+	}
+	for _, hash := range []string{
+		strings.ToUpper(hash),
+		strings.Repeat("../", 18) + "etc/passwd",
+		hash[:63],
+	} {
+		if p, ok := parseBlobPointer([]byte(blobPointer{hash: hash, size: 4}.String())); ok {
+			t.Fatal("expected invalid pointer, got", p)
+		}
+	}
+}
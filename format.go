@@ -0,0 +1,238 @@
+package autogold
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexops/autogold/v2/internal/naming"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// FileFormat describes the format a value is written in to a golden file, see Format.
+type FileFormat int
+
+const (
+	// GoSyntax formats values as Go syntax. This is the default.
+	GoSyntax FileFormat = iota
+
+	// JSON formats values as indented JSON with sorted object keys, as produced by encoding/json.
+	JSON
+
+	// YAML formats values as YAML with sorted mapping keys. Values are converted to YAML via their
+	// JSON representation, so `json` struct tags are respected.
+	YAML
+
+	// Text formats values as plain text: strings and byte slices are written as-is, any other value
+	// is written as formatted by fmt.Sprint.
+	Text
+
+	// Binary writes values as raw bytes, and shows mismatches as a hex dump diff. Values must be
+	// of type []byte, string, Raw or implement encoding.BinaryMarshaler.
+	Binary
+)
+
+// String implements fmt.Stringer.
+func (f FileFormat) String() string {
+	switch f {
+	case GoSyntax:
+		return "GoSyntax"
+	case JSON:
+		return "JSON"
+	case YAML:
+		return "YAML"
+	case Text:
+		return "Text"
+	case Binary:
+		return "Binary"
+	}
+	return fmt.Sprintf("FileFormat(%d)", int(f))
+}
+
+// extension returns the file extension of golden files written in this format.
+func (f FileFormat) extension() string {
+	switch f {
+	case JSON:
+		return ".golden.json"
+	case YAML:
+		return ".golden.yaml"
+	case Text:
+		return ".golden.txt"
+	case Binary:
+		return ".golden.bin"
+	}
+	return ".golden"
+}
+
+// goldenExtensions are the file extensions of all golden files autogold may write.
+var goldenExtensions = naming.Extensions
+
+func fileFormat(opts []Option) FileFormat {
+	for _, opt := range opts {
+		opt := opt.(*option)
+		if opt.format != GoSyntax {
+			return opt.format
+		}
+	}
+	return GoSyntax
+}
+
+// formatFile formats v for writing to a golden file, in the format specified by the options.
+//
+// Values of type Raw are always used as-is, regardless of the format. Protocol Buffers messages are
+// formatted using the protobuf text format, or the protobuf JSON mapping for JSON and YAML.
+func formatFile(v interface{}, opts []Option) (string, error) {
+	format := fileFormat(opts)
+	if m, ok := v.(proto.Message); ok {
+		return formatProto(m, format)
+	}
+	if format == GoSyntax {
+		return stringify(v, opts), nil
+	}
+	if v, ok := v.(Raw); ok {
+		return string(v), nil
+	}
+	v = sortSlices(v, opts)
+	switch format {
+	case JSON:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("formatting as JSON: %w", err)
+		}
+		return canonicalJSON(data)
+	case YAML:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("formatting as YAML: %w", err)
+		}
+		return jsonToYAML(data)
+	case Text:
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		return s, nil
+	case Binary:
+		switch v := v.(type) {
+		case []byte:
+			return string(v), nil
+		case string:
+			return v, nil
+		case encoding.BinaryMarshaler:
+			data, err := v.MarshalBinary()
+			if err != nil {
+				return "", fmt.Errorf("formatting as binary: %w", err)
+			}
+			return string(data), nil
+		}
+		return "", fmt.Errorf("formatting as binary: unsupported type %T", v)
+	}
+	return "", fmt.Errorf("unknown format %v", format)
+}
+
+// canonicalJSON reformats the JSON document data with sorted object keys, two-space indentation
+// and a trailing newline. Numbers are preserved exactly as written.
+func canonicalJSON(data []byte) (string, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// decodeJSON decodes a single JSON document, using json.Number for numbers.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after top-level JSON value")
+	}
+	return v, nil
+}
+
+// jsonToYAML converts the JSON document data to YAML with sorted mapping keys and two-space
+// indentation.
+func jsonToYAML(data []byte) (string, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNode(v)); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// yamlToJSON converts the YAML document data to JSON, for comparing documents by value. Mappings
+// with keys that are not strings are not supported.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// yamlNode converts a value decoded by decodeJSON into a YAML node, so that number literals are
+// preserved and mapping keys are sorted.
+func yamlNode(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			node.Content = append(node.Content, yamlNode(key), yamlNode(v[key]))
+		}
+		return node
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, elem := range v {
+			node.Content = append(node.Content, yamlNode(elem))
+		}
+		return node
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
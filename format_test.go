@@ -0,0 +1,124 @@
+package autogold
+
+import (
+	"testing"
+)
+
+type formatValue struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Ratio   float64           `json:"ratio"`
+	Labels  map[string]string `json:"labels"`
+	Enabled bool              `json:"enabled"`
+	Parent  *formatValue      `json:"parent,omitempty"`
+}
+
+func TestExpectFile_format(t *testing.T) {
+	got := formatValue{
+		Name:    "example: with a colon",
+		Count:   42,
+		Ratio:   0.5,
+		Labels:  map[string]string{"zeta": "last", "alpha": "first"},
+		Enabled: true,
+		Parent:  &formatValue{Name: "parent"},
+	}
+	tests := []struct {
+		name   string
+		format FileFormat
+		got    interface{}
+	}{
+		{name: "json", format: JSON, got: got},
+		{name: "yaml", format: YAML, got: got},
+		{name: "text", format: Text, got: "plain text\nwithout a trailing newline"},
+		{name: "text_stringer", format: Text, got: GoSyntax},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			ExpectFile(t, tst.got, Format(tst.format))
+		})
+	}
+}
+
+func Test_canonicalJSON(t *testing.T) {
+	got, err := canonicalJSON([]byte(`{"b": [1, 2.50, 1e3], "a": {"d": null, "c": "<>"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "a": {
+    "c": "<>",
+    "d": null
+  },
+  "b": [
+    1,
+    2.50,
+    1e3
+  ]
+}
+`
+	if got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func Test_goldenExtensions(t *testing.T) {
+	for _, ext := range []string{
+		GoSyntax.extension(),
+		JSON.extension(),
+		YAML.extension(),
+		Text.extension(),
+		Binary.extension(),
+		imageExtension,
+		archiveExtension,
+		hashExtension,
+	} {
+		if !isGoldenFile("TestFoo" + ext) {
+			t.Fatal("missing golden extension", ext)
+		}
+	}
+}
+
+func Test_diff_format(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    FileFormat
+		got, want string
+		diff      string
+	}{
+		{
+			name:   "json",
+			format: JSON,
+			want:   "{\n  \"a\": 1,\n  \"b\": [\n    \"x\"\n  ]\n}\n",
+			got:    "{\n  \"a\": 2,\n  \"b\": [\n    \"x\",\n    \"y\"\n  ]\n}\n",
+			diff:   "$.a: 1 -> 2\n+$.b[1]: \"y\"\n",
+		},
+		{
+			name:   "yaml",
+			format: YAML,
+			want:   "a: 1\nb:\n  - x\n",
+			got:    "a: 1\nb:\n  - z\nc: true\n",
+			diff:   "$.b[0]: \"x\" -> \"z\"\n+$.c: true\n",
+		},
+		{
+			name:   "json_formatting_only",
+			format: JSON,
+			want:   "{\"a\": 1}\n",
+			got:    "{\n  \"a\": 1\n}\n",
+			diff:   "--- want.json\n+++ got.json\n@@ -1 +1,3 @@\n-{\"a\": 1}\n+{\n+  \"a\": 1\n+}\n",
+		},
+		{
+			name:   "equal",
+			format: YAML,
+			want:   "a: 1\n",
+			got:    "a: 1\n",
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			got := diff(tst.got, tst.want, []Option{Format(tst.format)})
+			if got != tst.diff {
+				t.Fatal("\ngot:\n", got, "\nwant:\n", tst.diff)
+			}
+		})
+	}
+}
@@ -10,6 +10,8 @@ require (
 	github.com/hexops/valast v1.4.4
 	github.com/nightlyone/lockfile v1.0.0
 	golang.org/x/tools v0.30.0
+	google.golang.org/protobuf v1.36.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
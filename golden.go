@@ -0,0 +1,243 @@
+package autogold
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/pending"
+)
+
+// goldenPaths assigns the golden file paths used by tests.
+var goldenPaths = newGoldenPathRegistry()
+
+// goldenPathRegistry assigns golden file paths to tests, giving repeated uses of the same path by a
+// test a numeric suffix and detecting collisions between tests.
+type goldenPathRegistry struct {
+	mu sync.Mutex
+
+	// calls counts the uses of each unsanitized golden file path, keyed by test name.
+	calls map[string]map[string]int
+
+	// owners maps lowercased golden file paths to the unsanitized path of the first test that used
+	// them, in order to detect collisions.
+	owners map[string]string
+}
+
+func newGoldenPathRegistry() *goldenPathRegistry {
+	return &goldenPathRegistry{calls: map[string]map[string]int{}, owners: map[string]string{}}
+}
+
+// start records that the test is using golden files, reporting whether it had not done so yet.
+func (r *goldenPathRegistry) start(test string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.calls[test]; ok {
+		return false
+	}
+	r.calls[test] = map[string]int{}
+	return true
+}
+
+// finish forgets the uses of golden file paths by the test, once it has finished.
+func (r *goldenPathRegistry) finish(test string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.calls, test)
+}
+
+// path returns the path of the golden file for the next use of the golden file name by the test,
+// see goldenPath. explicit indicates the name was chosen using the Name option.
+func (r *goldenPathRegistry) path(test string, layout func(name string) string, name string, explicit bool) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls, ok := r.calls[test]
+	if !ok {
+		calls = map[string]int{}
+		r.calls[test] = calls
+	}
+	unsanitized := layout(name)
+	calls[unsanitized]++
+	suffix := ""
+	if n := calls[unsanitized]; n > 1 {
+		if explicit {
+			return "", fmt.Errorf("autogold: golden file %s is used more than once by this test, use a unique Name for each call", unsanitized)
+		}
+		suffix = fmt.Sprintf(".%d", n)
+	}
+	path := layout(sanitizeName(name) + suffix)
+	unsanitized = layout(name + suffix)
+
+	key := strings.ToLower(path)
+	if owner, ok := r.owners[key]; ok && owner != unsanitized {
+		return "", fmt.Errorf("autogold: %s and %s would both use golden file %s, rename one of the tests or use the Name option", owner, unsanitized, path)
+	}
+	r.owners[key] = unsanitized
+	return path, nil
+}
+
+// goldenPath returns the path of the golden file with the given extension for the test, i.e.
+// `testdata/<test name><ext>` by default, or as determined by the PathFunc and PathTemplate
+// options. The test name is sanitized (see sanitizeName) so that it is a valid path on all common
+// filesystems.
+//
+// If the test uses the same golden path more than once (e.g. by calling ExpectFile twice), the
+// subsequent calls are given a numeric suffix, e.g. `testdata/<test name>.2<ext>`, so that they do
+// not overwrite each other. Suffixes are assigned in call order, so calls must be made in a
+// deterministic order. If the path was chosen explicitly using the Name option, the test is failed
+// instead.
+//
+// If two distinct test names map to the same golden path (after sanitization, or because they
+// differ only by case) the test is failed, as their golden files would overwrite each other.
+func goldenPath(t *testing.T, opts []Option, ext string) string {
+	layout, name := goldenLayout(t, opts, ext), testName(t, opts)
+
+	if _, isOS := baseStore(goldenStore(opts)).(osStore); isOS && shouldRecordUsage() {
+		if root, ok := layoutRoot(layout); ok {
+			recordCleanupRoot(t, root)
+		}
+	}
+
+	if goldenPaths.start(t.Name()) {
+		t.Cleanup(func() { goldenPaths.finish(t.Name()) })
+	}
+	explicit := false
+	for _, opt := range opts {
+		if opt.(*option).name != "" {
+			explicit = true
+		}
+	}
+	path, err := goldenPaths.path(t.Name(), layout, name, explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// goldenFile manages reading, updating and cleaning up a single golden file on behalf of a test.
+type goldenFile struct {
+	t     *testing.T
+	path  string
+	store Store
+
+	// dir is the directory containing the golden file, which is what we lock and clean up.
+	dir    string
+	unlock func() error
+
+	// missing indicates the golden file did not exist when read.
+	missing bool
+}
+
+// openGoldenFile prepares the golden file at path in the store specified by opts for use by the
+// test. If -clean is specified, it is recorded as used so that it is not removed (see Run).
+//
+// The caller must call close when done with the golden file.
+func openGoldenFile(t *testing.T, opts []Option, path string) *goldenFile {
+	// At this point the testdata dir may be "testdata/" while path may be
+	// "testdata/TestFoo/subTest.golden". Use the directory of the golden file itself so we can rely
+	// on it for e.g. removing unused .golden files in it, locking it (instead of the entire
+	// "testdata/" directory), etc.
+	g := &goldenFile{t: t, path: path, store: goldenStore(opts), dir: filepath.Dir(path)}
+
+	// Golden files are only cleaned up on the OS filesystem, see Run.
+	if _, isOS := baseStore(g.store).(osStore); isOS {
+		restoreLegacyCleanDir(t, g.dir)
+		recordCleanup(t, path)
+	}
+
+	// Proposed golden files from a previous `-update=pending` run are replaced by this one, and
+	// removed if the golden file now matches.
+	if pendingUpdate() {
+		g.removeFile(pending.Path(path))
+	}
+	return g
+}
+
+// lock acquires a directory-level lock to prevent concurrent mutations to the golden files by
+// parallel tests (whether in-process, or not.)
+func (g *goldenFile) lock() {
+	if g.unlock != nil {
+		return
+	}
+	var err error
+	g.unlock, err = g.store.Lock(g.dir)
+	if err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+// close releases the directory-level lock, if held.
+func (g *goldenFile) close() {
+	if g.unlock != nil {
+		if err := g.unlock(); err != nil {
+			g.t.Fatal(err)
+		}
+		g.unlock = nil
+	}
+}
+
+// read returns the contents of the golden file, or nil if it does not exist. With `-update`, golden
+// files whose external blob is missing or corrupt are also read as nil, so that they are rewritten.
+func (g *goldenFile) read() []byte {
+	data, err := g.store.ReadFile(g.path)
+	var broken *brokenBlobError
+	if errors.As(err, &broken) && update() {
+		g.t.Logf("%v, rewriting it", err)
+		return nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		g.t.Fatal(err)
+	}
+	g.missing = err != nil
+	return data
+}
+
+// write replaces the contents of the golden file, creating it if needed. With `-update=pending`,
+// the proposed golden file is written instead (see pendingUpdate.)
+func (g *goldenFile) write(data []byte) {
+	g.lock()
+	if pendingUpdate() {
+		if err := g.store.WriteFile(pending.Path(g.path), data); err != nil {
+			g.t.Fatal(err)
+		}
+		return
+	}
+	if err := g.store.WriteFile(g.path, data); err != nil {
+		g.t.Fatal(err)
+	}
+	if _, isOS := baseStore(g.store).(osStore); isOS && g.missing {
+		// The golden file was created, possibly for a renamed test (see Run).
+		recordCreated(g.t, g.path)
+		g.missing = false
+	}
+}
+
+// writeFile writes a file in the golden file directory, e.g. an artifact next to the golden file.
+// Such files are never stored externally.
+func (g *goldenFile) writeFile(path string, data []byte) {
+	g.lock()
+	if err := baseStore(g.store).WriteFile(path, data); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+// remove removes the golden file, if it exists.
+func (g *goldenFile) remove() {
+	g.removeFile(g.path)
+}
+
+// removeFile removes a file in the golden file directory, if it exists.
+func (g *goldenFile) removeFile(path string) {
+	store := baseStore(g.store)
+	if _, err := store.ReadFile(path); errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	g.lock()
+	if err := store.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		g.t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+package autogold
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func testdataLayout(name string) string {
+	return filepath.Join("testdata", name+".golden")
+}
+
+func Test_goldenPathRegistry_repeated(t *testing.T) {
+	r := newGoldenPathRegistry()
+	var got []string
+	for i := 0; i < 3; i++ {
+		path, err := r.path("TestFoo", testdataLayout, "TestFoo", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, path)
+	}
+	want := []string{
+		filepath.FromSlash("testdata/TestFoo.golden"),
+		filepath.FromSlash("testdata/TestFoo.2.golden"),
+		filepath.FromSlash("testdata/TestFoo.3.golden"),
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+		}
+	}
+}
+
+func Test_goldenPathRegistry_explicitNameTwice(t *testing.T) {
+	r := newGoldenPathRegistry()
+	if _, err := r.path("TestFoo", testdataLayout, "my-name", true); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.path("TestFoo", testdataLayout, "my-name", true)
+	want := "autogold: golden file " + filepath.FromSlash("testdata/my-name.golden") + " is used more than once by this test, use a unique Name for each call"
+	if err == nil || err.Error() != want {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", want)
+	}
+
+	// Once the test has finished, its next run may use the name again.
+	r.finish("TestFoo")
+	if _, err := r.path("TestFoo", testdataLayout, "my-name", true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_goldenPathRegistry_collisions(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second string
+		want          string
+	}{
+		{
+			name:   "case",
+			first:  "TestFoo",
+			second: "Testfoo",
+			want:   "autogold: " + filepath.FromSlash("testdata/TestFoo.golden") + " and " + filepath.FromSlash("testdata/Testfoo.golden") + " would both use golden file " + filepath.FromSlash("testdata/Testfoo.golden") + ", rename one of the tests or use the Name option",
+		},
+		{
+			name:   "sanitization",
+			first:  "TestFoo/a:b",
+			second: "TestFoo/a?b",
+			want:   "autogold: " + filepath.FromSlash("testdata/TestFoo/a:b.golden") + " and " + filepath.FromSlash("testdata/TestFoo/a?b.golden") + " would both use golden file " + filepath.FromSlash("testdata/TestFoo/a_b.golden") + ", rename one of the tests or use the Name option",
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			r := newGoldenPathRegistry()
+			if _, err := r.path(tst.first, testdataLayout, tst.first, false); err != nil {
+				t.Fatal(err)
+			}
+			_, err := r.path(tst.second, testdataLayout, tst.second, false)
+			if err == nil || err.Error() != tst.want {
+				t.Fatal("\ngot:\n", err, "\nwant:\n", tst.want)
+			}
+
+			// The first test may keep using its own golden file.
+			r.finish(tst.first)
+			if _, err := r.path(tst.first, testdataLayout, tst.first, false); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
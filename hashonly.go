@@ -0,0 +1,83 @@
+package autogold
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hashExtension is the file extension of hash-only golden files.
+const hashExtension = ".golden.sha256"
+
+// HashOnly specifies that ExpectFile should store only the SHA-256 digest and size of the formatted
+// value in `testdata/<test name>.golden.sha256`, instead of the value itself. This is useful for
+// very large but deterministic outputs, where only whether they changed matters.
+//
+// When a mismatch fails the test, the full output is written for inspection to a temporary
+// directory, or to the directory given by the AUTOGOLD_ARTIFACTS_DIR environment variable (e.g. a
+// CI artifacts directory) if set.
+func HashOnly() Option {
+	return &option{hashOnly: true}
+}
+
+func hashOnly(opts []Option) bool {
+	for _, opt := range opts {
+		if opt.(*option).hashOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// goldenDigest returns the contents of a hash-only golden file for the given output.
+func goldenDigest(output string) string {
+	return fmt.Sprintf("sha256 %x\nsize %d\n", sha256.Sum256([]byte(output)), len(output))
+}
+
+// writeArtifact writes the full output of a hash-only golden file test for inspection, returning
+// the path it was written to.
+func writeArtifact(t *testing.T, goldenPath, output string, opts []Option) string {
+	dir, err := artifactsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimSuffix(goldenPath, hashExtension) + fileFormat(opts).extension()
+	if filepath.IsAbs(name) {
+		name = filepath.Base(name)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(output), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var (
+	tempArtifactsDirMu sync.Mutex
+	tempArtifactsDir   string
+)
+
+// artifactsDir returns the directory to write artifacts to: the AUTOGOLD_ARTIFACTS_DIR environment
+// variable if set, or else a temporary directory shared by all tests in the process.
+func artifactsDir() (string, error) {
+	if dir := os.Getenv("AUTOGOLD_ARTIFACTS_DIR"); dir != "" {
+		return dir, nil
+	}
+	tempArtifactsDirMu.Lock()
+	defer tempArtifactsDirMu.Unlock()
+	if tempArtifactsDir == "" {
+		dir, err := os.MkdirTemp("", "autogold-")
+		if err != nil {
+			return "", err
+		}
+		tempArtifactsDir = dir
+	}
+	return tempArtifactsDir, nil
+}
@@ -0,0 +1,51 @@
+package autogold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpectFile_hashOnly(t *testing.T) {
+	ExpectFile(t, Raw(strings.Repeat("a large but deterministic output\n", 1000)), HashOnly())
+}
+
+func Test_writeArtifact(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AUTOGOLD_ARTIFACTS_DIR", dir)
+
+	got := writeArtifact(t, filepath.Join("testdata", "TestFoo", "bar.golden.sha256"), "{}\n", []Option{Format(JSON)})
+	want := filepath.Join(dir, "testdata", "TestFoo", "bar.golden.json")
+	if got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	data, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}\n" {
+		t.Fatal("\ngot:\n", string(data), "\nwant:\n", "{}\n")
+	}
+}
+
+func Test_artifactsDir(t *testing.T) {
+	t.Setenv("AUTOGOLD_ARTIFACTS_DIR", "")
+
+	// A single temporary directory is used for all artifacts of the process.
+	a, err := artifactsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := artifactsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("\ngot:\n", b, "\nwant:\n", a)
+	}
+	os.RemoveAll(a)
+	tempArtifactsDirMu.Lock()
+	tempArtifactsDir = ""
+	tempArtifactsDirMu.Unlock()
+}
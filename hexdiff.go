@@ -0,0 +1,98 @@
+package autogold
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hexDiffRowSize is the number of bytes displayed per row of a hex dump diff.
+const hexDiffRowSize = 16
+
+// hexDiffContext is the number of unchanged rows displayed around each changed row.
+const hexDiffContext = 1
+
+// hexDiff compares got and want as binary data, returning an empty string if they are equal.
+//
+// Otherwise, a diff of offset-aligned hex dump rows (in the style of `hexdump -C`) is returned,
+// with only the rows that differ (and some context around them) shown.
+func hexDiff(got, want string) string {
+	if got == want {
+		return ""
+	}
+	rows := (max(len(got), len(want)) + hexDiffRowSize - 1) / hexDiffRowSize
+	row := func(s string, r int) (string, bool) {
+		start := r * hexDiffRowSize
+		if start >= len(s) {
+			return "", false
+		}
+		return s[start:min(start+hexDiffRowSize, len(s))], true
+	}
+	changed := make([]bool, rows)
+	for r := range changed {
+		wantRow, wantOK := row(want, r)
+		gotRow, gotOK := row(got, r)
+		changed[r] = wantRow != gotRow || wantOK != gotOK
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- want (%d bytes)\n+++ got (%d bytes)\n", len(want), len(got))
+	lastShown := -1
+	for r := 0; r < rows; r++ {
+		show := false
+		for c := max(0, r-hexDiffContext); c <= min(rows-1, r+hexDiffContext); c++ {
+			if changed[c] {
+				show = true
+				break
+			}
+		}
+		if !show {
+			continue
+		}
+		if r != lastShown+1 {
+			fmt.Fprintf(&b, "@@ offset %08x @@\n", r*hexDiffRowSize)
+		}
+		lastShown = r
+		wantRow, wantOK := row(want, r)
+		gotRow, gotOK := row(got, r)
+		if !changed[r] {
+			b.WriteString(" " + hexDumpRow(r*hexDiffRowSize, wantRow) + "\n")
+			continue
+		}
+		if wantOK {
+			b.WriteString("-" + hexDumpRow(r*hexDiffRowSize, wantRow) + "\n")
+		}
+		if gotOK {
+			b.WriteString("+" + hexDumpRow(r*hexDiffRowSize, gotRow) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// hexDumpRow formats a single row of at most hexDiffRowSize bytes starting at the given offset,
+// e.g.:
+//
+//	00000010  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 0a        |Hello, world!.|
+func hexDumpRow(offset int, row string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%08x  ", offset)
+	for i := 0; i < hexDiffRowSize; i++ {
+		if i < len(row) {
+			fmt.Fprintf(&b, "%02x ", row[i])
+		} else {
+			b.WriteString("   ")
+		}
+		if i == hexDiffRowSize/2-1 {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(" |")
+	for i := 0; i < len(row); i++ {
+		if c := row[i]; c >= 0x20 && c < 0x7f {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('.')
+		}
+	}
+	b.WriteByte('|')
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package autogold
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpectFile_binary(t *testing.T) {
+	got := []byte{0x00, 0x01, 0xff, 'a', 'u', 't', 'o', 'g', 'o', 'l', 'd', '\n', 0x7f}
+	ExpectFile(t, got, Format(Binary))
+}
+
+func Test_hexDiff(t *testing.T) {
+	want := strings.Repeat("0123456789abcdef", 5)
+	got := []byte(want)
+	got[40] = 0x00
+	got = append(got, "tail"...)
+
+	diff := hexDiff(string(got), want)
+	expected := `--- want (80 bytes)
++++ got (84 bytes)
+@@ offset 00000010 @@
+ 00000010  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|
+-00000020  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|
++00000020  30 31 32 33 34 35 36 37  00 39 61 62 63 64 65 66  |01234567.9abcdef|
+ 00000030  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|
+ 00000040  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|
++00000050  74 61 69 6c                                       |tail|
+`
+	if diff != expected {
+		t.Fatal("\ngot:\n", diff, "\nwant:\n", expected)
+	}
+	if diff := hexDiff(want, want); diff != "" {
+		t.Fatal("expected no diff, got:\n", diff)
+	}
+}
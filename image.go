@@ -0,0 +1,133 @@
+package autogold
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// ImageTolerance is an option for ExpectImage which allows images to differ slightly from the
+// golden image.
+//
+// A pixel differs if any of its 8-bit (non-alpha-premultiplied) color channels differ by more than
+// channel, and the comparison fails if the ratio of differing pixels to total pixels is greater than
+// maxDiffRatio (e.g. 0.01 for 1%.)
+func ImageTolerance(channel uint8, maxDiffRatio float64) Option {
+	return &option{imageTolerance: &imageTolerance{channel: channel, maxDiffRatio: maxDiffRatio}}
+}
+
+// imageExtension is the file extension of golden images.
+const imageExtension = ".golden.png"
+
+type imageTolerance struct {
+	channel      uint8
+	maxDiffRatio float64
+}
+
+// ExpectImage checks if img is equal to the saved `testdata/<test name>.golden.png` image. If it is
+// not, the test is failed and an image highlighting the differing pixels in red is written to
+// `testdata/<test name>.diff.png` for inspection.
+//
+// By default images must match exactly, use ImageTolerance to allow small differences.
+//
+// If the `go test -update` flag is specified, the golden image will be updated/created
+// automatically and the test will not fail unless `-fail-on-update` is specified.
+func ExpectImage(t *testing.T, img image.Image, opts ...Option) {
+	golden := openGoldenFile(t, opts, goldenPath(t, opts, imageExtension))
+	defer golden.close()
+	diffFile := strings.TrimSuffix(golden.path, imageExtension) + ".diff.png"
+
+	tolerance := imageTolerance{}
+	for _, opt := range opts {
+		opt := opt.(*option)
+		if opt.imageTolerance != nil {
+			tolerance = *opt.imageTolerance
+		}
+	}
+
+	var mismatch string
+	var diffImage image.Image
+	if wantData := golden.read(); wantData == nil {
+		mismatch = fmt.Sprintf("golden image %s does not exist", golden.path)
+	} else if want, err := png.Decode(bytes.NewReader(wantData)); err != nil {
+		mismatch = fmt.Sprintf("decoding golden image %s: %v", golden.path, err)
+	} else {
+		mismatch, diffImage = compareImages(want, img, tolerance)
+	}
+	if mismatch == "" {
+		golden.removeFile(diffFile)
+		return
+	}
+
+	if update() {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		golden.write(buf.Bytes())
+		golden.removeFile(diffFile)
+	} else if diffImage != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, diffImage); err != nil {
+			t.Fatal(err)
+		}
+		golden.writeFile(diffFile, buf.Bytes())
+		mismatch += fmt.Sprintf(" (differences written to %s)", diffFile)
+	}
+	if *failOnUpdate || !update() {
+		t.Log(fmt.Errorf("image mismatch: %s", mismatch))
+		t.FailNow()
+	}
+}
+
+// compareImages compares the got image against the want image, returning a description of the
+// mismatch (empty if they match within the given tolerance) and an image highlighting the
+// differences if their sizes match.
+func compareImages(want, got image.Image, tolerance imageTolerance) (mismatch string, diff image.Image) {
+	wantBounds, gotBounds := want.Bounds(), got.Bounds()
+	if wantBounds.Size() != gotBounds.Size() {
+		return fmt.Sprintf("size %v differs from golden image size %v", gotBounds.Size(), wantBounds.Size()), nil
+	}
+
+	size := wantBounds.Size()
+	diffImage := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	differing := 0
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			w := color.NRGBAModel.Convert(want.At(wantBounds.Min.X+x, wantBounds.Min.Y+y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(gotBounds.Min.X+x, gotBounds.Min.Y+y)).(color.NRGBA)
+			if channelDiff(w.R, g.R) > tolerance.channel ||
+				channelDiff(w.G, g.G) > tolerance.channel ||
+				channelDiff(w.B, g.B) > tolerance.channel ||
+				channelDiff(w.A, g.A) > tolerance.channel {
+				differing++
+				diffImage.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+				continue
+			}
+			// Show matching pixels as a faded grayscale version of the golden image, so the
+			// differences stand out.
+			gray := color.GrayModel.Convert(w).(color.Gray)
+			faded := 255 - (255-gray.Y)/4
+			diffImage.SetNRGBA(x, y, color.NRGBA{R: faded, G: faded, B: faded, A: 255})
+		}
+	}
+	total := size.X * size.Y
+	if differing == 0 || total == 0 || float64(differing)/float64(total) <= tolerance.maxDiffRatio {
+		return "", nil
+	}
+	return fmt.Sprintf(
+		"%d of %d pixels (%.2f%%) differ by more than %d per channel, %.2f%% allowed",
+		differing, total, 100*float64(differing)/float64(total), tolerance.channel, 100*tolerance.maxDiffRatio,
+	), diffImage
+}
+
+func channelDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,67 @@
+package autogold
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestExpectImage(t *testing.T) {
+	ExpectImage(t, testImage())
+}
+
+func Test_compareImages(t *testing.T) {
+	want := testImage()
+	got := testImage()
+	got.SetNRGBA(0, 0, color.NRGBA{R: 2, G: 0, B: 128, A: 255}) // off by 2 in one channel
+	got.SetNRGBA(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+
+	tests := []struct {
+		name      string
+		tolerance imageTolerance
+		mismatch  string
+	}{
+		{
+			name:     "exact",
+			mismatch: "2 of 128 pixels (1.56%) differ by more than 0 per channel, 0.00% allowed",
+		},
+		{
+			name:      "channel_tolerance",
+			tolerance: imageTolerance{channel: 2},
+			mismatch:  "1 of 128 pixels (0.78%) differ by more than 2 per channel, 0.00% allowed",
+		},
+		{
+			name:      "ratio_tolerance",
+			tolerance: imageTolerance{channel: 2, maxDiffRatio: 0.01},
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			mismatch, diff := compareImages(want, got, tst.tolerance)
+			if mismatch != tst.mismatch {
+				t.Fatal("\ngot:\n", mismatch, "\nwant:\n", tst.mismatch)
+			}
+			if (diff != nil) != (tst.mismatch != "") {
+				t.Fatal("unexpected diff image", diff)
+			}
+			if diff != nil && diff.At(1, 0) != (color.NRGBA{R: 255, A: 255}) {
+				t.Fatal("expected differing pixel to be red, got", diff.At(1, 0))
+			}
+		})
+	}
+
+	mismatch, _ := compareImages(want, image.NewNRGBA(image.Rect(0, 0, 1, 1)), imageTolerance{})
+	if want := "size (1,1) differs from golden image size (16,8)"; mismatch != want {
+		t.Fatal("\ngot:\n", mismatch, "\nwant:\n", want)
+	}
+}
@@ -0,0 +1,93 @@
+// Package atomicfile writes files atomically, shared by the autogold package and the autogold
+// command so that golden files and test files are never left partially written.
+package atomicfile
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes data to the named file such that an interrupted write (e.g. a killed test
+// process) never leaves it truncated: data is written to a temporary file in the same directory,
+// synced to disk and then renamed into place.
+//
+// If the file exists its mode is preserved, otherwise it is created with perm (before umask). If
+// the file is a symlink, the file it points to is replaced instead of the symlink itself.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	target, err := resolveSymlinks(name)
+	if err != nil {
+		return err
+	}
+	var existingMode *os.FileMode
+	if info, err := os.Stat(target); err == nil {
+		mode := info.Mode().Perm()
+		existingMode = &mode
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return err
+	}
+	dir, base := filepath.Split(target)
+	tmp := filepath.Join(dir, "."+base+"."+hex.EncodeToString(suffix[:])+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // no-op once renamed
+
+	_, err = f.Write(data)
+	if err == nil && existingMode != nil {
+		err = f.Chmod(*existingMode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+
+	// Sync the directory so that the rename itself is durable. Not all platforms support this, so it
+	// is best-effort.
+	if d, err := os.Open(filepath.Dir(target)); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// resolveSymlinks returns the path of the file which name refers to, following any symlinks even if
+// the file they point to does not exist yet.
+func resolveSymlinks(name string) (string, error) {
+	for i := 0; i < 255; i++ {
+		info, err := os.Lstat(name)
+		if os.IsNotExist(err) || (err == nil && info.Mode()&os.ModeSymlink == 0) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		link, err := os.Readlink(name)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(name), link)
+		}
+		name = link
+	}
+	return "", &os.PathError{Op: "resolve", Path: name, Err: errSymlinkLoop}
+}
+
+var errSymlinkLoop = errors.New("too many levels of symbolic links")
@@ -0,0 +1,86 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.golden")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("new"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatal("\ngot:\n", info.Mode().Perm(), "\nwant:\n", os.FileMode(0o600))
+	}
+
+	if runtime.GOOS != "windows" {
+		// Symlinks are followed, including those to files which do not exist yet.
+		if err := os.Symlink("file.golden", filepath.Join(dir, "link.golden")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("sub", "target.golden"), filepath.Join(dir, "dangling.golden")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(filepath.Join(dir, "link.golden"), []byte("via link"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(filepath.Join(dir, "dangling.golden"), []byte("created"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		for _, link := range []string{"link.golden", "dangling.golden"} {
+			if info, err := os.Lstat(filepath.Join(dir, link)); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Fatal("expected symlink to be preserved:", link, err)
+			}
+		}
+	}
+
+	want := map[string]string{"file.golden": "new"}
+	if runtime.GOOS != "windows" {
+		want = map[string]string{
+			"file.golden":       "via link",
+			"link.golden":       "via link",
+			"dangling.golden":   "created",
+			"sub/target.golden": "created",
+		}
+	}
+	got := map[string]string{}
+	for name := range want {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[name] = string(data)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".tmp" {
+			t.Fatal("unexpected temporary file", e.Name())
+		}
+	}
+}
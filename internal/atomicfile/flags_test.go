@@ -0,0 +1,4 @@
+package atomicfile_test
+
+// This import is here so that `go test ./... -update` in the repository root doesn't fail.
+import _ "github.com/hexops/autogold/v2"
@@ -0,0 +1,141 @@
+// Package naming implements the rules by which autogold names golden files after tests, shared by
+// the autogold package and the autogold command.
+package naming
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultDir is the directory golden files are written to by default, relative to the package
+// directory.
+const DefaultDir = "testdata"
+
+// Extensions are the file extensions of all golden files autogold may write.
+var Extensions = []string{
+	".golden",
+	".golden.json",
+	".golden.yaml",
+	".golden.txt",
+	".golden.bin",
+	".golden.png",
+	".golden.txtar",
+	".golden.sha256",
+}
+
+// IsGolden reports whether path has the extension of a golden file autogold writes.
+func IsGolden(path string) bool {
+	for _, ext := range Extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extension returns the golden file extension of path, e.g. ".golden.json".
+func Extension(path string) string {
+	ext := filepath.Ext(path)
+	for _, goldenExt := range Extensions {
+		if strings.HasSuffix(path, goldenExt) && len(goldenExt) > len(ext) {
+			ext = goldenExt
+		}
+	}
+	return ext
+}
+
+// IsTestFunc reports whether name is the name of a test function with the given prefix, e.g.
+// "TestFoo" but not "Testfoo", using the same rule as the go tool.
+func IsTestFunc(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) || name == "TestMain" {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// numberedSuffix matches the suffix given to golden files used more than once by a test.
+var numberedSuffix = regexp.MustCompile(`\.[0-9]+$`)
+
+// TestName returns the (sanitized) name of the test which the golden file at path, within the
+// golden file root, belongs to, e.g. "TestFoo/sub" for "testdata/TestFoo/sub.2.golden.json".
+func TestName(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	name := strings.TrimSuffix(filepath.ToSlash(rel), Extension(rel))
+	return numberedSuffix.ReplaceAllString(name, ""), true
+}
+
+// maxNameComponentLength is the maximum length in bytes of a sanitized golden file path component,
+// leaving room for suffixes and extensions within the 255 byte limit of most filesystems.
+const maxNameComponentLength = 100
+
+// windowsReservedNames are file names which cannot be used on Windows, regardless of extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize converts a test name (e.g. "TestFoo/my subtest") into a relative file path which
+// is valid on all common filesystems. Each slash-separated component of the name is sanitized as
+// follows:
+//
+//   - The characters < > : " \ | ? * and control characters are replaced with _
+//   - Trailing dots and spaces are replaced with _ (which also makes "." and ".." safe)
+//   - Empty components become _
+//   - Windows reserved device names (CON, NUL, COM1, etc.) are prefixed with _
+//   - Components longer than 100 bytes are truncated, and a hash of the full component is appended
+//     so that they remain unique, e.g. "TestVeryLong…-1a2b3c4d"
+//
+// Names which are already valid, which is the case for most test names, are unchanged.
+func Sanitize(name string) string {
+	components := strings.Split(name, "/")
+	for i, component := range components {
+		components[i] = sanitizeNameComponent(component)
+	}
+	return strings.Join(components, "/")
+}
+
+func sanitizeNameComponent(component string) string {
+	s := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, component)
+
+	trimmed := strings.TrimRight(s, ". ")
+	s = trimmed + strings.Repeat("_", len(s)-len(trimmed))
+	if s == "" {
+		s = "_"
+	}
+
+	base := s
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(base)] {
+		s = "_" + s
+	}
+
+	if len(s) > maxNameComponentLength {
+		hash := fmt.Sprintf("-%x", sha256.Sum256([]byte(component)))[:9]
+		cut := maxNameComponentLength - len(hash)
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + hash
+	}
+	return s
+}
@@ -0,0 +1,115 @@
+package pending
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// hunk is a single hunk of a unified diff.
+type hunk struct {
+	fromLine int  // 1-based
+	empty    bool // the hunk header names zero lines, i.e. fromLine is the line to insert after
+	old, new []string
+}
+
+// Apply applies the unified diff patch to src, as produced by Unified, and returns the result.
+//
+// Unlike the patch tool, Apply does not search for a hunk's context elsewhere in the file: each
+// hunk must apply exactly at the lines it names. An error is returned otherwise, e.g. if the file
+// was changed after the patch was written.
+func Apply(src, patch string) (string, error) {
+	hunks, err := parseHunks(patch)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(src, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	pos := 0
+	for _, h := range hunks {
+		start := h.fromLine - 1
+		if h.empty {
+			start = h.fromLine
+		}
+		if start < pos || start+len(h.old) > len(lines) {
+			return "", fmt.Errorf("hunk at line %d does not apply", h.fromLine)
+		}
+		for i, line := range h.old {
+			if lines[start+i] != line {
+				return "", fmt.Errorf("hunk at line %d does not apply: line %d differs", h.fromLine, start+i+1)
+			}
+		}
+		for _, line := range lines[pos:start] {
+			out.WriteString(line)
+		}
+		for _, line := range h.new {
+			out.WriteString(line)
+		}
+		pos = start + len(h.old)
+	}
+	for _, line := range lines[pos:] {
+		out.WriteString(line)
+	}
+	return out.String(), nil
+}
+
+// parseHunks parses the hunks of a unified diff, ignoring any file headers.
+func parseHunks(patch string) ([]*hunk, error) {
+	var (
+		hunks []*hunk
+		h     *hunk
+
+		// last is the kind of the last line added to h, for "\ No newline at end of file" markers.
+		last byte
+	)
+	for n, line := range strings.SplitAfter(patch, "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || fields[3] != "@@" {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", n+1, strings.TrimSpace(line))
+			}
+			from, count, _ := strings.Cut(strings.TrimPrefix(fields[1], "-"), ",")
+			fromLine, err := strconv.Atoi(from)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", n+1, strings.TrimSpace(line))
+			}
+			h = &hunk{fromLine: fromLine, empty: count == "0"}
+			hunks = append(hunks, h)
+			last = 0
+			continue
+		}
+		if h == nil {
+			continue // file headers
+		}
+		switch line[0] {
+		case ' ':
+			h.old = append(h.old, line[1:])
+			h.new = append(h.new, line[1:])
+		case '-':
+			h.old = append(h.old, line[1:])
+		case '+':
+			h.new = append(h.new, line[1:])
+		case '\\':
+			if last != ' ' && last != '-' && last != '+' {
+				return nil, fmt.Errorf("line %d: unexpected %q", n+1, strings.TrimSpace(line))
+			}
+			if last == ' ' || last == '-' {
+				h.old[len(h.old)-1] = strings.TrimSuffix(h.old[len(h.old)-1], "\n")
+			}
+			if last == ' ' || last == '+' {
+				h.new[len(h.new)-1] = strings.TrimSuffix(h.new[len(h.new)-1], "\n")
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", n+1, strings.TrimSpace(line))
+		}
+		last = line[0]
+	}
+	return hunks, nil
+}
@@ -0,0 +1,336 @@
+// Package pending implements reviewing the pending snapshots written by `go test -update=pending`,
+// i.e. proposed golden files and proposed changes to autogold.Expect calls in _test.go files.
+//
+// It is shared by the autogold package, which writes pending snapshots, and the autogold command,
+// which lists, diffs, accepts and rejects them.
+package pending
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hexops/autogold/v2/internal/atomicfile"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+const (
+	// Suffix is appended to the path of a golden file (or golden directory) to form the path of the
+	// proposed golden file, e.g. `testdata/TestFoo.golden.new`.
+	Suffix = ".new"
+
+	// PatchSuffix is appended to the path of a _test.go file to form the path of the patch file
+	// containing the proposed changes to its autogold.Expect calls, e.g. `foo_test.go.autogold.patch`.
+	PatchSuffix = ".autogold.patch"
+)
+
+// Path returns the path of the proposed golden file or directory for the given golden path.
+func Path(golden string) string { return golden + Suffix }
+
+// PatchPath returns the path of the patch file for the given _test.go file.
+func PatchPath(testFile string) string { return testFile + PatchSuffix }
+
+// Kind describes what a pending snapshot proposes to change.
+type Kind int
+
+const (
+	// File is a proposed golden file, which replaces the golden file when accepted.
+	File Kind = iota
+
+	// Dir is a proposed golden directory (see autogold.ExpectDir), which replaces the golden
+	// directory when accepted.
+	Dir
+
+	// Patch is a patch to a _test.go file, which updates its autogold.Expect calls when applied.
+	Patch
+)
+
+// String implements fmt.Stringer.
+func (k Kind) String() string {
+	switch k {
+	case File:
+		return "file"
+	case Dir:
+		return "dir"
+	case Patch:
+		return "patch"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Snapshot is a pending snapshot on disk.
+type Snapshot struct {
+	// Path is the path of the proposed golden file or directory, or of the patch file.
+	Path string
+
+	// Target is the path of the golden file or directory, or of the _test.go file, that is changed
+	// when the snapshot is accepted.
+	Target string
+
+	Kind Kind
+}
+
+// String implements fmt.Stringer.
+func (s Snapshot) String() string {
+	return s.Target
+}
+
+// snapshotAt returns the pending snapshot at the given path, if the path names one. If strict is set,
+// .new files and directories are only considered pending snapshots if they are in a testdata
+// directory or named like golden files, so that unrelated .new files are left alone.
+func snapshotAt(path string, isDir, strict bool) (Snapshot, bool) {
+	base := filepath.Base(path)
+	switch {
+	case !isDir && strings.HasSuffix(base, "_test.go"+PatchSuffix):
+		return Snapshot{Path: path, Target: strings.TrimSuffix(path, PatchSuffix), Kind: Patch}, true
+	case strings.HasSuffix(base, Suffix) && base != Suffix:
+		target := strings.TrimSuffix(path, Suffix)
+		if strict && !strings.Contains(filepath.Base(target), ".golden") && !inTestdata(path) {
+			return Snapshot{}, false
+		}
+		kind := File
+		if isDir {
+			kind = Dir
+		}
+		return Snapshot{Path: path, Target: target, Kind: kind}, true
+	}
+	return Snapshot{}, false
+}
+
+func inTestdata(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if elem == "testdata" {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the pending snapshots in the given directory, recursively, sorted by path.
+// Directories whose names begin with "." or "_", and vendor directories, are skipped like the go
+// tool does.
+func Find(root string) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root {
+			if name := d.Name(); strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" {
+				return filepath.SkipDir
+			}
+		}
+		if s, ok := snapshotAt(path, d.IsDir(), true); ok {
+			snapshots = append(snapshots, s)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Path < snapshots[j].Path })
+	return snapshots, nil
+}
+
+// Open returns the pending snapshot for the given path, which may be the path of the pending
+// snapshot itself or of the golden file, golden directory or _test.go file it changes. Unlike Find,
+// any .new file or directory named this way is considered a pending snapshot.
+func Open(path string) (Snapshot, error) {
+	path = filepath.Clean(path)
+	for _, candidate := range []string{path, Path(path), PatchPath(path)} {
+		info, err := os.Stat(candidate)
+		if err != nil {
+			continue
+		}
+		if s, ok := snapshotAt(candidate, info.IsDir(), false); ok {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("no pending snapshot for %s", path)
+}
+
+// Change is a change to a single file proposed by a pending snapshot.
+type Change struct {
+	// Name is the path of the file that is changed, i.e. the target of the snapshot, or a file in the
+	// target golden directory.
+	Name string
+
+	// Want is the current contents of the file, and Got the proposed contents. Either is nil if the
+	// file does not exist, or is removed, respectively.
+	Want, Got []byte
+}
+
+// Changes returns the changes the snapshot proposes, sorted by name. For golden directories, only
+// the files which change are included.
+func (s Snapshot) Changes() ([]Change, error) {
+	switch s.Kind {
+	case Patch:
+		src, err := os.ReadFile(s.Target)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := os.ReadFile(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		patched, err := Apply(string(src), string(patch))
+		if err != nil {
+			return nil, fmt.Errorf("applying %s: %w", s.Path, err)
+		}
+		return []Change{{Name: s.Target, Want: src, Got: []byte(patched)}}, nil
+	case Dir:
+		want, err := readDir(s.Target)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		got, err := readDir(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		names := map[string]bool{}
+		for name := range want {
+			names[name] = true
+		}
+		for name := range got {
+			names[name] = true
+		}
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		var changes []Change
+		for _, name := range sorted {
+			if want[name] != nil && got[name] != nil && string(want[name]) == string(got[name]) {
+				continue
+			}
+			changes = append(changes, Change{Name: filepath.Join(s.Target, name), Want: want[name], Got: got[name]})
+		}
+		return changes, nil
+	}
+	want, err := os.ReadFile(s.Target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	got, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return []Change{{Name: s.Target, Want: want, Got: got}}, nil
+}
+
+// Diff returns a unified diff of the changes the snapshot proposes.
+func (s Snapshot) Diff() (string, error) {
+	if s.Kind == Patch {
+		patch, err := os.ReadFile(s.Path)
+		return string(patch), err
+	}
+	changes, err := s.Changes()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		gotName := Path(c.Name)
+		if s.Kind == Dir {
+			rel, err := filepath.Rel(s.Target, c.Name)
+			if err != nil {
+				return "", err
+			}
+			gotName = filepath.Join(s.Path, rel)
+		}
+		b.WriteString(Unified(c.Name, gotName, string(c.Want), string(c.Got)))
+	}
+	return b.String(), nil
+}
+
+// Accept applies the changes the snapshot proposes and removes it.
+func (s Snapshot) Accept() error {
+	switch s.Kind {
+	case Patch:
+		patch, err := os.ReadFile(s.Path)
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(s.Target)
+		if err != nil {
+			return err
+		}
+		patched, err := Apply(string(src), string(patch))
+		if err != nil {
+			return fmt.Errorf("applying %s: %w", s.Path, err)
+		}
+		if err := atomicfile.WriteFile(s.Target, []byte(patched), 0o666); err != nil {
+			return err
+		}
+		return os.Remove(s.Path)
+	case Dir:
+		if err := os.RemoveAll(s.Target); err != nil {
+			return err
+		}
+		return os.Rename(s.Path, s.Target)
+	}
+	// Write the golden file rather than renaming the proposed one onto it, so that its mode is
+	// preserved and symlinks are followed as when autogold writes it.
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(s.Target, data, 0o666); err != nil {
+		return err
+	}
+	return os.Remove(s.Path)
+}
+
+// Reject removes the snapshot, leaving the golden file or _test.go file as-is.
+func (s Snapshot) Reject() error {
+	if s.Kind == Dir {
+		return os.RemoveAll(s.Path)
+	}
+	return os.Remove(s.Path)
+}
+
+// Unified returns a unified diff from the want to the got contents, or a summary line if either is
+// not valid UTF-8 text. It returns an empty string if they are equal.
+func Unified(wantName, gotName, want, got string) string {
+	if want == got {
+		return ""
+	}
+	if !utf8.ValidString(want) || !utf8.ValidString(got) {
+		return fmt.Sprintf("Binary files %s (%d bytes) and %s (%d bytes) differ\n", wantName, len(want), gotName, len(got))
+	}
+	edits := myers.ComputeEdits(span.URIFromPath(wantName), want, got)
+	return fmt.Sprint(gotextdiff.ToUnified(wantName, gotName, want, edits))
+}
+
+// readDir reads all files in dir recursively, returning their contents keyed by path relative to
+// dir.
+func readDir(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = data
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,223 @@
+package pending
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"foo_test.go":                        "package foo\n",
+		"foo_test.go.autogold.patch":         "",
+		"notes.new":                          "not a snapshot",
+		"testdata/TestA.golden.new":          "a",
+		"testdata/TestB.golden.json.new":     "{}",
+		"testdata/TestDir.new/out.txt":       "out",
+		"testdata/TestDir.new/x.golden.new":  "not separately pending",
+		"layout/TestC.golden.new":            "c",
+		".hidden/testdata/TestD.golden.new":  "d",
+		"vendor/x/testdata/TestE.golden.new": "e",
+	})
+
+	snapshots, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range snapshots {
+		rel, _ := filepath.Rel(dir, s.Target)
+		got = append(got, s.Kind.String()+" "+filepath.ToSlash(rel))
+	}
+	want := []string{
+		"patch foo_test.go",
+		"file layout/TestC.golden",
+		"file testdata/TestA.golden",
+		"file testdata/TestB.golden.json",
+		"dir testdata/TestDir",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{"testdata/TestA.golden.new": "a"})
+	pendingPath := filepath.Join(dir, "testdata", "TestA.golden.new")
+	for _, path := range []string{pendingPath, filepath.Join(dir, "testdata", "TestA.golden")} {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Path != pendingPath || s.Kind != File {
+			t.Fatal("\ngot:\n", s, "\nwant:\n", pendingPath)
+		}
+	}
+	if _, err := Open(filepath.Join(dir, "testdata", "TestB.golden")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSnapshot_Accept(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.golden":               "old\n",
+		"TestA.golden.new":           "new\n",
+		"TestDir/removed.txt":        "removed\n",
+		"TestDir.new/a/b.txt":        "added\n",
+		"foo_test.go":                "package foo\n\nvar x = 1\n",
+		"foo_test.go.autogold.patch": "--- foo_test.go\n+++ foo_test.go\n@@ -2,2 +2,2 @@\n \n-var x = 1\n+var x = 2\n",
+	})
+	for _, path := range []string{"TestA.golden", "TestDir", "foo_test.go"} {
+		s, err := Open(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Accept(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+			t.Fatal("expected pending snapshot to be removed, got", err)
+		}
+	}
+	if got, want := readFile(t, filepath.Join(dir, "TestA.golden")), "new\n"; got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	if got, want := readFile(t, filepath.Join(dir, "TestDir", "a", "b.txt")), "added\n"; got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "TestDir", "removed.txt")); !os.IsNotExist(err) {
+		t.Fatal("expected file to be removed, got", err)
+	}
+	if got, want := readFile(t, filepath.Join(dir, "foo_test.go")), "package foo\n\nvar x = 2\n"; got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func TestSnapshot_Reject(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.golden":      "old\n",
+		"TestA.golden.new":  "new\n",
+		"TestDir.new/a.txt": "a\n",
+	})
+	for _, path := range []string{"TestA.golden", "TestDir"} {
+		s, err := Open(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reject(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+			t.Fatal("expected pending snapshot to be removed, got", err)
+		}
+	}
+	if got, want := readFile(t, filepath.Join(dir, "TestA.golden")), "old\n"; got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func TestSnapshot_Diff(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestA.golden":           "a\nb\n",
+		"TestA.golden.new":       "a\nc\n",
+		"TestBin.golden.bin.new": "\xff",
+	})
+	var got string
+	for _, path := range []string{"TestA.golden", "TestBin.golden.bin"} {
+		s, err := Open(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff, err := s.Diff()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, s.Target)
+		got += rel + ":\n" + diff
+	}
+	want := "TestA.golden:\n" +
+		"--- " + filepath.Join(dir, "TestA.golden") + "\n" +
+		"+++ " + filepath.Join(dir, "TestA.golden.new") + "\n" +
+		"@@ -1,2 +1,2 @@\n a\n-b\n+c\n" +
+		"TestBin.golden.bin:\n" +
+		"Binary files " + filepath.Join(dir, "TestBin.golden.bin") + " (0 bytes) and " + filepath.Join(dir, "TestBin.golden.bin.new") + " (1 bytes) differ\n"
+	if got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range []struct{ before, after string }{
+		{"a\nb\nc\n", "a\nB\nc\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"},
+		{"a\nb", "a\nc"},
+		{"a\n", "a\nb"},
+		{"", "a\n"},
+	} {
+		patch := Unified("x", "x", tc.before, tc.after)
+		got, err := Apply(tc.before, patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.after {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", tc.after)
+		}
+	}
+
+	patch := Unified("x", "x", "a\nb\nc\n", "a\nB\nc\n")
+	if _, err := Apply("a\nchanged\nc\n", patch); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSnapshot_Changes(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestDir/same.txt":           "same\n",
+		"TestDir/removed.txt":        "removed\n",
+		"TestDir.new/same.txt":       "same\n",
+		"TestDir.new/added.txt":      "added\n",
+		"foo_test.go":                "package foo\n\nvar x = 1\n",
+		"foo_test.go.autogold.patch": "--- foo_test.go\n+++ foo_test.go\n@@ -2,2 +2,2 @@\n \n-var x = 1\n+var x = 2\n",
+	})
+	var got []string
+	for _, path := range []string{"TestDir", "foo_test.go"} {
+		s, err := Open(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := s.Changes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range changes {
+			rel, _ := filepath.Rel(dir, c.Name)
+			got = append(got, fmt.Sprintf("%s %q -> %q", filepath.ToSlash(rel), c.Want, c.Got))
+		}
+	}
+	want := []string{
+		`TestDir/added.txt "" -> "added\n"`,
+		`TestDir/removed.txt "removed\n" -> ""`,
+		`foo_test.go "package foo\n\nvar x = 1\n" -> "package foo\n\nvar x = 2\n"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
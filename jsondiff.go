@@ -0,0 +1,169 @@
+package autogold
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SemanticJSON is an option that compares golden files containing JSON semantically: whitespace,
+// object key order and number formatting (e.g. 1.0 and 1) are ignored, and differences are
+// reported by their JSON path, e.g.:
+//
+//	$.items[3].price: 10 -> 12
+//
+// If either the golden file or the value does not contain valid JSON, a regular text diff is used.
+func SemanticJSON() Option {
+	return &option{semanticJSON: true}
+}
+
+func semanticJSON(opts []Option) bool {
+	for _, opt := range opts {
+		if opt.(*option).semanticJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonDiff compares the JSON documents got and want, returning ok=false if either is not valid
+// JSON. Otherwise, the differences are returned one per line (empty if they are equal.)
+func jsonDiff(got, want string) (diff string, ok bool) {
+	gotValue, err := decodeJSON([]byte(got))
+	if err != nil {
+		return "", false
+	}
+	wantValue, err := decodeJSON([]byte(want))
+	if err != nil {
+		return "", false
+	}
+	var lines []string
+	compareJSON(&lines, "$", wantValue, gotValue)
+	if len(lines) == 0 {
+		return "", true
+	}
+	return strings.Join(lines, "\n") + "\n", true
+}
+
+// structuredDiff compares the JSON or YAML documents got and want by value, returning ok=false if
+// either cannot be decoded. Otherwise, the differences are returned one per line as by jsonDiff.
+func structuredDiff(got, want string, format FileFormat) (diff string, ok bool) {
+	if format == JSON {
+		return jsonDiff(got, want)
+	}
+	gotJSON, err := yamlToJSON([]byte(got))
+	if err != nil {
+		return "", false
+	}
+	wantJSON, err := yamlToJSON([]byte(want))
+	if err != nil {
+		return "", false
+	}
+	return jsonDiff(string(gotJSON), string(wantJSON))
+}
+
+// compareJSON appends a line to diff for every difference between the want and got values, which
+// must be values produced by decodeJSON.
+func compareJSON(diff *[]string, path string, want, got interface{}) {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(want)+len(got))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		for key := range got {
+			if _, ok := want[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := jsonPathKey(path, key)
+			wantValue, inWant := want[key]
+			gotValue, inGot := got[key]
+			switch {
+			case !inGot:
+				*diff = append(*diff, fmt.Sprintf("-%s: %s", keyPath, compactJSON(wantValue)))
+			case !inWant:
+				*diff = append(*diff, fmt.Sprintf("+%s: %s", keyPath, compactJSON(gotValue)))
+			default:
+				compareJSON(diff, keyPath, wantValue, gotValue)
+			}
+		}
+		return
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(want) || i < len(got); i++ {
+			indexPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(got):
+				*diff = append(*diff, fmt.Sprintf("-%s: %s", indexPath, compactJSON(want[i])))
+			case i >= len(want):
+				*diff = append(*diff, fmt.Sprintf("+%s: %s", indexPath, compactJSON(got[i])))
+			default:
+				compareJSON(diff, indexPath, want[i], got[i])
+			}
+		}
+		return
+	case json.Number:
+		if got, ok := got.(json.Number); ok && jsonNumbersEqual(want, got) {
+			return
+		}
+	default:
+		if want == got {
+			return
+		}
+	}
+	*diff = append(*diff, fmt.Sprintf("%s: %s -> %s", path, compactJSON(want), compactJSON(got)))
+}
+
+func jsonNumbersEqual(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	ar, ok := new(big.Rat).SetString(a.String())
+	if !ok {
+		return false
+	}
+	br, ok := new(big.Rat).SetString(b.String())
+	if !ok {
+		return false
+	}
+	return ar.Cmp(br) == 0
+}
+
+// jsonPathKey returns the JSON path of the given object key, e.g. `$.foo` or `$["foo bar"]`.
+func jsonPathKey(path, key string) string {
+	isIdent := key != ""
+	for i, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			isIdent = false
+			break
+		}
+	}
+	if isIdent {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func compactJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
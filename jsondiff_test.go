@@ -0,0 +1,56 @@
+package autogold
+
+import (
+	"testing"
+)
+
+func Test_jsonDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want string
+		diff      string
+		notJSON   bool
+	}{
+		{
+			name: "whitespace_and_key_order",
+			want: `{"a": 1, "b": [true, null]}`,
+			got: `{
+	"b": [true, null],
+	"a": 1.0
+}`,
+		},
+		{
+			name: "changes",
+			want: `{"items": [{"price": 10}, {"price": 5}], "name": "x", "old key": 1}`,
+			got:  `{"items": [{"price": 12}, {"price": 5}, {"price": 1}], "name": "x", "new": {"a": "<b>"}}`,
+			diff: `$.items[0].price: 10 -> 12
++$.items[2]: {"price":1}
++$.new: {"a":"<b>"}
+-$["old key"]: 1
+`,
+		},
+		{
+			name: "type_change",
+			want: `{"a": 1}`,
+			got:  `{"a": "1"}`,
+			diff: "$.a: 1 -> \"1\"\n",
+		},
+		{
+			name:    "not_json",
+			want:    `{"a": 1}`,
+			got:     `{"a": 1`,
+			notJSON: true,
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			diff, ok := jsonDiff(tst.got, tst.want)
+			if ok == tst.notJSON {
+				t.Fatal("\ngot ok:\n", ok, "\nwant ok:\n", !tst.notJSON)
+			}
+			if diff != tst.diff {
+				t.Fatal("\ngot:\n", diff, "\nwant:\n", tst.diff)
+			}
+		})
+	}
+}
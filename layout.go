@@ -0,0 +1,142 @@
+package autogold
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// PathFunc specifies a function which determines the path of golden files, instead of the default
+// `testdata/<test name>` layout. It is given the (sanitized) test name, or the name given by the
+// Name option, and returns the path of the golden file relative to the package directory. The golden
+// file extension (e.g. ".golden" or ".golden.json") is appended to the returned path.
+//
+// For example, to group golden files by the top-level test:
+//
+//	autogold.PathFunc(func(testName string) string {
+//		return filepath.Join("testdata", "golden", testName)
+//	})
+//
+// The Dir option has no effect when PathFunc is used.
+func PathFunc(f func(testName string) string) Option {
+	return &option{pathFunc: f}
+}
+
+// PathTemplate specifies a text/template which determines the full path of golden files, instead of
+// the default `{{.Dir}}/{{.Test}}.{{.Ext}}` layout. For example, to group golden files by the
+// _test.go file which defines the test:
+//
+//	autogold.PathTemplate("testdata/{{.File}}/{{.Test}}.{{.Ext}}")
+//
+// The template is given the following values:
+//
+//   - {{.Dir}}: the directory given by the Dir option, "testdata" by default.
+//   - {{.Test}}: the (sanitized) test name, or the name given by the Name option.
+//   - {{.Ext}}: the golden file extension without the leading dot, e.g. "golden" or "golden.json".
+//     It is empty for ExpectDir, which uses a directory instead of a file (a dot preceding it at the
+//     end of the path is removed.)
+//   - {{.File}}: the name of the _test.go file calling autogold, without the "_test.go" suffix.
+//   - {{.Package}}: the name of the package under test.
+//
+// Golden files may use a custom extension (e.g. "{{.Test}}.json"), in which case -clean only removes
+// files with that extension which are named after a test that used golden files, so that other
+// files in the same directories (e.g. "testdata/input.json") are left as-is.
+//
+// PathTemplate panics if the template is invalid.
+func PathTemplate(text string) Option {
+	return &option{pathTemplate: template.Must(template.New("autogold.PathTemplate").Parse(text))}
+}
+
+// layoutData is the data given to PathTemplate templates.
+type layoutData struct {
+	Dir, Test, Ext string
+	file           string
+}
+
+// File returns the name of the _test.go file calling autogold, without the "_test.go" suffix.
+func (d layoutData) File() string {
+	return strings.TrimSuffix(filepath.Base(d.file), "_test.go")
+}
+
+// Package returns the name of the package under test.
+func (d layoutData) Package() (string, error) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	name, _, err := getPackageNameAndPath(pwd, d.file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(name, "_test"), nil
+}
+
+// goldenLayout returns a function mapping a test name to the path of its golden file with the given
+// extension, according to the PathFunc or PathTemplate options if specified.
+func goldenLayout(t *testing.T, opts []Option, ext string) func(name string) string {
+	dir := testdataDir(opts)
+	for _, opt := range opts {
+		opt := opt.(*option)
+		if opt.pathFunc != nil {
+			return func(name string) string {
+				return filepath.Clean(opt.pathFunc(name) + ext)
+			}
+		}
+		if opt.pathTemplate != nil {
+			file, ok := callerTestFile()
+			if !ok {
+				t.Fatal("runtime.Caller: returned ok=false")
+			}
+			return func(name string) string {
+				var b strings.Builder
+				data := layoutData{Dir: dir, Test: name, Ext: strings.TrimPrefix(ext, "."), file: file}
+				if err := opt.pathTemplate.Execute(&b, data); err != nil {
+					t.Fatal(fmt.Errorf("autogold: PathTemplate: %v", err))
+				}
+				path := filepath.Clean(filepath.FromSlash(b.String()))
+				if ext == "" {
+					// Avoid a trailing dot in "{{.Test}}.{{.Ext}}" for ExpectDir.
+					path = strings.TrimSuffix(path, ".")
+				}
+				return path
+			}
+		}
+	}
+	return func(name string) string {
+		return filepath.Join(dir, name) + ext
+	}
+}
+
+// layoutRoot returns the directory which contains the golden files of all tests (and their subtests)
+// for the given layout, e.g. "testdata" for the default layout. It returns false if there is no
+// such directory other than the package directory, or a directory outside of it.
+func layoutRoot(layout func(name string) string) (string, bool) {
+	a, b := filepath.Dir(layout("0")), filepath.Dir(layout("1"))
+	for a != b {
+		a, b = filepath.Dir(a), filepath.Dir(b)
+	}
+	if a == "." || a == filepath.Dir(a) || a == ".." || strings.HasPrefix(a, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return a, true
+}
+
+// goldenPatterns returns the glob patterns matching golden files in the same directory as path,
+// which -clean considers for removal.
+func goldenPatterns(path string) []string {
+	patterns := make([]string, 0, len(goldenExtensions)+1)
+	custom := true
+	for _, ext := range goldenExtensions {
+		patterns = append(patterns, "*"+ext)
+		if strings.HasSuffix(path, ext) {
+			custom = false
+		}
+	}
+	if ext := filepath.Ext(path); custom && ext != "" {
+		patterns = append(patterns, "*"+ext)
+	}
+	return patterns
+}
@@ -0,0 +1,77 @@
+package autogold
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	ExpectFile(t, "grouped by test file", PathTemplate("testdata/{{.File}}/{{.Test}}.{{.Ext}}"))
+	ExpectFile(t, map[string]int{"a": 1}, PathTemplate("{{.Dir}}/{{.Package}}/{{.Test}}.json"), Format(JSON))
+}
+
+func TestPathFunc(t *testing.T) {
+	ExpectFile(t, "custom layout", PathFunc(func(testName string) string {
+		return filepath.Join("testdata", "layout", "func", testName)
+	}))
+}
+
+func Test_goldenPath_layout(t *testing.T) {
+	t.Run("sub/test", func(t *testing.T) {
+		opts := []Option{PathTemplate("{{.Dir}}/{{.File}}/{{.Test}}.{{.Ext}}"), Dir("other")}
+		got := []string{
+			goldenPath(t, opts, ".golden"),
+			goldenPath(t, opts, ".golden"),
+			goldenPath(t, opts, ".golden.json"),
+			goldenPath(t, opts, ""),
+		}
+		want := []string{
+			filepath.FromSlash("other/layout/Test_goldenPath_layout/sub/test.golden"),
+			filepath.FromSlash("other/layout/Test_goldenPath_layout/sub/test.2.golden"),
+			filepath.FromSlash("other/layout/Test_goldenPath_layout/sub/test.golden.json"),
+			filepath.FromSlash("other/layout/Test_goldenPath_layout/sub/test"),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+		}
+	})
+}
+
+func Test_goldenPatterns(t *testing.T) {
+	got := goldenPatterns(filepath.Join("testdata", "TestFoo.json"))
+	var want []string
+	for _, ext := range goldenExtensions {
+		want = append(want, "*"+ext)
+	}
+	want = append(want, "*.json")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	if got := goldenPatterns(filepath.Join("testdata", "TestFoo.golden.json")); len(got) != len(goldenExtensions) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", goldenExtensions)
+	}
+}
+
+func Test_layoutRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		want   string
+		wantOk bool
+	}{
+		{name: "default", want: "testdata", wantOk: true},
+		{name: "dir", opts: []Option{Dir(filepath.Join("testdata", "golden"))}, want: filepath.Join("testdata", "golden"), wantOk: true},
+		{name: "template", opts: []Option{PathTemplate("testdata/{{.File}}/{{.Test}}.{{.Ext}}")}, want: filepath.Join("testdata", "layout"), wantOk: true},
+		{name: "package dir", opts: []Option{PathTemplate("{{.Test}}.{{.Ext}}")}, wantOk: false},
+		{name: "parent dir", opts: []Option{Dir("..")}, wantOk: false},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			got, ok := layoutRoot(goldenLayout(t, tst.opts, ".golden"))
+			if got != tst.want || ok != tst.wantOk {
+				t.Fatal("\ngot:\n", got, ok, "\nwant:\n", tst.want, tst.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package autogold
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_acquirePathLock(t *testing.T) {
+	t.Setenv("AUTOGOLD_LOCK_DIR", t.TempDir())
+	t.Setenv("AUTOGOLD_LOCK_TIMEOUT", "100ms")
+	path, err := filepath.Abs(filepath.Join("testdata", "Test_acquirePathLock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockFile := lockPath(path)
+	writeLock := func(pid int) {
+		if err := os.WriteFile(lockFile, []byte(fmt.Sprintf("%d\n", pid)), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Held by another process (the go command which is running the tests.)
+	writeLock(os.Getppid())
+	_, err = acquirePathLock(path)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Fatal("expected lock timeout, got", err)
+	}
+
+	// Released by the other process while waiting.
+	t.Setenv("AUTOGOLD_LOCK_TIMEOUT", "10s")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(lockFile)
+	}()
+	unlock, err := acquirePathLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held by a process which no longer exists.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	writeLock(cmd.Process.Pid)
+	unlock, err = acquirePathLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held by a live process for too long, e.g. because the PID of a killed process was reused.
+	writeLock(os.Getppid())
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = acquirePathLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
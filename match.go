@@ -0,0 +1,70 @@
+package autogold
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/hexops/autogold/v2/internal/naming"
+)
+
+// The matching of test names against the -test.run and -test.skip patterns mirrors that of
+// $GOROOT/src/testing/match.go (see gomatch.go), so that -clean only removes golden files of tests
+// which ran.
+
+// testFilter determines whether tests ran according to the -test.run and -test.skip flags.
+type testFilter struct {
+	run, skip filterMatch
+}
+
+// newTestFilter returns a filter for the given -test.run and -test.skip patterns, or nil if all
+// tests run.
+func newTestFilter(run, skip string) (*testFilter, error) {
+	if run == "" && skip == "" {
+		return nil, nil
+	}
+	f := &testFilter{run: simpleMatch{}, skip: alternationMatch{}}
+	if run != "" {
+		f.run = splitRegexp(run)
+		if err := f.run.verify("-test.run"); err != nil {
+			return nil, err
+		}
+	}
+	if skip != "" {
+		f.skip = splitRegexp(skip)
+		if err := f.skip.verify("-test.skip"); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// flagTestFilter returns a filter for the -test.run and -test.skip flags of the test binary.
+func flagTestFilter() (*testFilter, error) {
+	lookup := func(name string) string {
+		if f := flag.Lookup(name); f != nil {
+			return f.Value.String()
+		}
+		return ""
+	}
+	return newTestFilter(lookup("test.run"), lookup("test.skip"))
+}
+
+// ran reports whether the test (or subtest) with the given name ran, including the case where only
+// some of its subtests ran.
+func (f *testFilter) ran(name string) bool {
+	if f == nil {
+		return true
+	}
+	elem := strings.Split(name, "/")
+	if ok, _ := f.run.matches(elem); !ok {
+		return false
+	}
+	skip, partialSkip := f.skip.matches(elem)
+	return !skip || partialSkip
+}
+
+// goldenTestName returns the (sanitized) name of the test which the golden file at path, within
+// the golden file root, belongs to, e.g. "TestFoo/sub" for "testdata/TestFoo/sub.2.golden.json".
+func goldenTestName(root, path string) (string, bool) {
+	return naming.TestName(root, path)
+}
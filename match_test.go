@@ -0,0 +1,68 @@
+package autogold
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_testFilter(t *testing.T) {
+	tests := []struct {
+		run, skip string
+		name      string
+		want      bool
+	}{
+		{run: "", name: "TestFoo", want: true},
+		{run: "TestFoo", name: "TestFoo", want: true},
+		{run: "TestFoo", name: "TestFoo/sub", want: true},
+		{run: "TestFoo", name: "TestFooBar", want: true},
+		{run: "^TestFoo$", name: "TestFooBar", want: false},
+		{run: "TestFoo/sub", name: "TestFoo", want: true},
+		{run: "TestFoo/sub", name: "TestFoo/sub", want: true},
+		{run: "TestFoo/sub", name: "TestFoo/other", want: false},
+		{run: "TestFoo/sub", name: "TestBar/sub", want: false},
+		{run: "TestFoo|TestBar", name: "TestBar/sub", want: true},
+		{run: "TestFoo/a|TestBar", name: "TestFoo/b", want: false},
+		{run: "TestFoo/[a/b]", name: "TestFoo/a", want: true},
+		{run: "TestFoo/my sub", name: "TestFoo/my_sub", want: true},
+		{skip: "TestFoo", name: "TestFoo", want: false},
+		{skip: "TestFoo", name: "TestFoo/sub", want: false},
+		{skip: "TestFoo", name: "TestBar", want: true},
+		{skip: "TestFoo/sub", name: "TestFoo", want: true},
+		{skip: "TestFoo/sub", name: "TestFoo/sub", want: false},
+		{run: "TestFoo", skip: "TestFoo/sub", name: "TestFoo/other", want: true},
+	}
+	for _, tst := range tests {
+		f, err := newTestFilter(tst.run, tst.skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.ran(tst.name); got != tst.want {
+			t.Errorf("-run=%q -skip=%q %s: got %v want %v", tst.run, tst.skip, tst.name, got, tst.want)
+		}
+	}
+
+	if _, err := newTestFilter("TestFoo/(", ""); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func Test_goldenTestName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "testdata/TestFoo.golden", want: "TestFoo"},
+		{path: "testdata/TestFoo/sub.2.golden.json", want: "TestFoo/sub"},
+		{path: "testdata/TestFoo/sub.golden.txtar", want: "TestFoo/sub"},
+		{path: "testdata/TestFoo.json", want: "TestFoo"},
+	}
+	for _, tst := range tests {
+		got, ok := goldenTestName("testdata", filepath.FromSlash(tst.path))
+		if !ok || got != tst.want {
+			t.Fatal("\ngot:\n", got, ok, "\nwant:\n", tst.want)
+		}
+	}
+	if _, ok := goldenTestName("testdata", filepath.Join("other", "TestFoo.golden")); ok {
+		t.Fatal("expected golden file outside of root to not have a test name")
+	}
+}
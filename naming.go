@@ -0,0 +1,10 @@
+package autogold
+
+import "github.com/hexops/autogold/v2/internal/naming"
+
+// sanitizeName converts a test name (e.g. "TestFoo/my subtest") into a relative file path which
+// is valid on all common filesystems, see naming.Sanitize. Names which are already valid, which is
+// the case for most test names, are unchanged.
+func sanitizeName(name string) string {
+	return naming.Sanitize(name)
+}
@@ -0,0 +1,39 @@
+package autogold
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_sanitizeName(t *testing.T) {
+	long := strings.Repeat("a", 150)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "TestFoo", want: "TestFoo"},
+		{name: "TestFoo/my_subtest#01", want: "TestFoo/my_subtest#01"},
+		{name: "TestFoo/a:b*c?d", want: "TestFoo/a_b_c_d"},
+		{name: `TestFoo/<"x"|y\z>`, want: "TestFoo/__x__y_z_"},
+		{name: "TestFoo/tab\there", want: "TestFoo/tab_here"},
+		{name: "TestFoo/trailing. .", want: "TestFoo/trailing___"},
+		{name: "TestFoo/..", want: "TestFoo/__"},
+		{name: "TestFoo//x", want: "TestFoo/_/x"},
+		{name: "TestFoo/con", want: "TestFoo/_con"},
+		{name: "TestFoo/NUL.txt", want: "TestFoo/_NUL.txt"},
+		{name: "TestFoo/console", want: "TestFoo/console"},
+		{name: "TestFoo/" + long, want: "TestFoo/" + strings.Repeat("a", 91) + "-7595af82"},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			got := sanitizeName(tst.name)
+			if got != tst.want {
+				t.Fatal("\ngot:\n", got, "\nwant:\n", tst.want)
+			}
+		})
+	}
+
+	if sanitizeName("TestFoo/"+long) == sanitizeName("TestFoo/"+long+"b") {
+		t.Fatal("expected long names differing only in their suffix to remain unique")
+	}
+}
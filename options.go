@@ -1,5 +1,7 @@
 package autogold
 
+import "text/template"
+
 // Option configures specific behavior for Equal.
 type Option interface {
 	// isValidOption is an unexported field to ensure only valid options from this package can be
@@ -11,6 +13,18 @@ type option struct {
 	name         string
 	exportedOnly bool
 	dir          string
+	sortSlices   bool
+	sortSlicesAt []string
+	sortSlicesBy *sortKey
+	format       FileFormat
+	semanticJSON bool
+	pathFunc     func(testName string) string
+	pathTemplate *template.Template
+	store        Store
+	blobs        BlobStore
+	hashOnly     bool
+
+	imageTolerance *imageTolerance
 
 	// internal options.
 	forPackageName, forPackagePath string
@@ -34,3 +48,11 @@ func Name(name string) Option {
 func Dir(dir string) Option {
 	return &option{dir: dir}
 }
+
+// Format specifies the format ExpectFile writes golden files in, instead of the default Go syntax.
+// The golden file extension is chosen to match, e.g. testdata/<name>.golden.json for JSON.
+//
+// Format has no effect on Expect, which always uses Go syntax.
+func Format(format FileFormat) Option {
+	return &option{format: format}
+}
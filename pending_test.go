@@ -0,0 +1,182 @@
+package autogold
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/pending"
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+// setUpdateFlag sets the -update flag for the duration of the test.
+func setUpdateFlag(t *testing.T, value string) {
+	setFlag(t, "update", value)
+}
+
+// setFlag sets the named flag for the duration of the test.
+func setFlag(t *testing.T, name, value string) {
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := flag.Set(name, old); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func Test_updateMode(t *testing.T) {
+	for _, tc := range []struct {
+		value         string
+		update        bool
+		pendingUpdate bool
+	}{
+		{value: "true", update: true},
+		{value: "false"},
+		{value: "pending", update: true, pendingUpdate: true},
+		{value: "1", update: true},
+	} {
+		var m updateMode
+		if err := m.Set(tc.value); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Get().(bool); got != tc.update {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", tc.update)
+		}
+		if got := m == updatePending; got != tc.pendingUpdate {
+			t.Fatal("\ngot:\n", got, "\nwant:\n", tc.pendingUpdate)
+		}
+	}
+	var m updateMode
+	if err := m.Set("later"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestExpectFile_pending(t *testing.T) {
+	setUpdateFlag(t, "pending")
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"match.golden":     "\"same\"\n",
+		"match.golden.new": "\"stale\"\n",
+	})
+
+	ExpectFile(t, "changed", Dir(dir))
+	ExpectFile(t, "same", Dir(dir), Name("match"))
+
+	golden := filepath.Join(dir, "TestExpectFile_pending.golden")
+	if _, err := os.Stat(golden); !os.IsNotExist(err) {
+		t.Fatal("expected golden file not to be written, got", err)
+	}
+	got, err := os.ReadFile(pending.Path(golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\"changed\"\n"; string(got) != want {
+		t.Fatal("\ngot:\n", string(got), "\nwant:\n", want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "match.golden.new")); !os.IsNotExist(err) {
+		t.Fatal("expected stale proposed golden file to be removed, got", err)
+	}
+}
+
+func TestExpect_pendingPasses(t *testing.T) {
+	setUpdateFlag(t, "pending")
+	file, ok := callerTestFile()
+	if !ok {
+		t.Fatal("runtime.Caller: returned ok=false")
+	}
+	patchPath := pending.PatchPath(file)
+	if err := os.WriteFile(patchPath, []byte("stale"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(patchPath) })
+	stalePatchesMu.Lock()
+	delete(stalePatches, file)
+	stalePatchesMu.Unlock()
+
+	// The patch of a previous run is removed once every autogold.Expect call passes.
+	Expect(1).Equal(t, 1)
+	if _, err := os.Stat(patchPath); !os.IsNotExist(err) {
+		t.Fatal("expected stale patch to be removed, got", err)
+	}
+}
+
+func TestExpectDir_pending(t *testing.T) {
+	setUpdateFlag(t, "pending")
+	src, dir := t.TempDir(), t.TempDir()
+	testutil.WriteFiles(t, src, map[string]string{"a.txt": "a\n", "b/c.txt": "c\n"})
+
+	ExpectDir(t, src, Dir(dir))
+
+	goldenDir := filepath.Join(dir, "TestExpectDir_pending")
+	if _, err := os.Stat(goldenDir); !os.IsNotExist(err) {
+		t.Fatal("expected golden directory not to be written, got", err)
+	}
+	got, err := readDirFiles(OSStore(), pending.Path(goldenDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a.txt": "a\n", "b/c.txt": "c\n"}; !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func Test_writeExpectPatch(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "foo_test.go")
+	before := "package foo\n\nvar want = autogold.Expect(1)\n"
+	if err := os.WriteFile(testFile, []byte(before), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	changes := &fileChanges{before: []byte(before), now: []byte("package foo\n\nvar want = autogold.Expect(2)\n")}
+	if err := writeExpectPatch(testFile, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	patch, err := os.ReadFile(pending.PatchPath(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- foo_test.go\n+++ foo_test.go\n@@ -1,3 +1,3 @@\n package foo\n \n-var want = autogold.Expect(1)\n+var want = autogold.Expect(2)\n"
+	if string(patch) != want {
+		t.Fatal("\ngot:\n", string(patch), "\nwant:\n", want)
+	}
+	if src, _ := os.ReadFile(testFile); string(src) != before {
+		t.Fatal("expected test file to be left as-is, got", string(src))
+	}
+
+	// Once there are no changes, the patch is removed.
+	changes.now = changes.before
+	if err := writeExpectPatch(testFile, changes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pending.PatchPath(testFile)); !os.IsNotExist(err) {
+		t.Fatal("expected patch to be removed, got", err)
+	}
+}
+
+func Test_discardStalePatch(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "foo_test.go")
+	patchPath := pending.PatchPath(testFile)
+	testutil.WriteFiles(t, filepath.Dir(testFile), map[string]string{"foo_test.go.autogold.patch": "stale"})
+
+	if err := discardStalePatch(testFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(patchPath); !os.IsNotExist(err) {
+		t.Fatal("expected stale patch to be removed, got", err)
+	}
+
+	// Patches written by this run are kept.
+	testutil.WriteFiles(t, filepath.Dir(testFile), map[string]string{"foo_test.go.autogold.patch": "new"})
+	if err := discardStalePatch(testFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(patchPath); err != nil {
+		t.Fatal(err)
+	}
+}
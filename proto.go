@@ -0,0 +1,266 @@
+package autogold
+
+import (
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// formatProto formats a Protocol Buffers message for writing to a golden file. Text and Go syntax
+// formats use the protobuf text format, JSON and YAML use the protobuf JSON mapping and Binary uses
+// the deterministic protobuf wire format.
+//
+// The protobuf encoders deliberately produce unstable whitespace, which is normalized here so the
+// output is deterministic across builds.
+func formatProto(m proto.Message, format FileFormat) (string, error) {
+	switch format {
+	case JSON, YAML:
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		if format == YAML {
+			return jsonToYAML(data)
+		}
+		return canonicalJSON(data)
+	case Binary:
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	data, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return normalizeProtoText(string(data)), nil
+}
+
+// normalizeProtoText removes the extra space prototext randomly emits after each field name, e.g.
+// `name:  "foo"` becomes `name: "foo"`. The input must be in multi-line form.
+func normalizeProtoText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		indented := strings.TrimLeft(line, " ")
+		indent := line[:len(line)-len(indented)]
+
+		// Find the end of the field name, which is either an identifier or an extension / Any
+		// type URL in brackets.
+		end := 0
+		if strings.HasPrefix(indented, "[") {
+			end = strings.Index(indented, "]") + 1
+		} else {
+			for end < len(indented) && isProtoIdentByte(indented[end]) {
+				end++
+			}
+		}
+		if end <= 0 {
+			continue
+		}
+		name, rest := indented[:end], indented[end:]
+		if strings.HasPrefix(rest, ":") {
+			name, rest = name+":", rest[1:]
+		}
+		if !strings.HasPrefix(rest, " ") {
+			continue
+		}
+		lines[i] = indent + name + " " + strings.TrimPrefix(rest[1:], " ")
+	}
+	s = strings.Join(lines, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+func isProtoIdentByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// protoInternalFields are the unexported fields of generated protobuf message structs which hold
+// internal state rather than message data.
+var protoInternalFields = map[string]bool{
+	"state":         true,
+	"sizeCache":     true,
+	"unknownFields": true,
+}
+
+// stripProtoInternals returns a copy of v in which the internal fields of any generated protobuf
+// message structs are zero, so they are omitted when formatted as Go syntax. If v contains no
+// protobuf messages, it is returned as-is.
+func stripProtoInternals(v interface{}) interface{} {
+	if v == nil {
+		return v
+	}
+	s := &protoStripper{
+		visited: map[reflect.Type]bool{},
+		seen:    map[pointerKey]bool{},
+		copies:  map[pointerKey]reflect.Value{},
+	}
+	rv := reflect.ValueOf(v)
+	if !s.reachesProto(rv) {
+		return v
+	}
+	c := reflect.New(rv.Type()).Elem()
+	c.Set(rv)
+	return s.copy(c).Interface()
+}
+
+type protoStripper struct {
+	visited map[reflect.Type]bool        // types currently being checked by containsProto
+	seen    map[pointerKey]bool          // pointers already checked by reachesProto
+	copies  map[pointerKey]reflect.Value // pointers already copied, to handle cyclic values
+}
+
+// copy returns a copy of v with protobuf internal fields zeroed. v must be addressable.
+func (s *protoStripper) copy(v reflect.Value) reflect.Value {
+	if !s.containsProto(v.Type()) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := pointerKey{v.Type(), v.Pointer()}
+		if c, ok := s.copies[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		s.copies[key] = c
+		c.Elem().Set(s.copy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		c := reflect.New(v.Type()).Elem()
+		c.Set(s.copy(elem))
+		return c
+	case reflect.Struct:
+		isMessage := reflect.PointerTo(v.Type()).Implements(protoMessageType)
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			field := c.Field(i)
+			field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+			if isMessage && protoInternalFields[c.Type().Field(i).Name] {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			field.Set(s.copy(field))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			c.SetMapIndex(iter.Key(), s.copy(value))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(s.copy(v.Index(i)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(s.copy(v.Index(i)))
+		}
+		return c
+	}
+	return v
+}
+
+// reachesProto reports whether a protobuf message struct is reachable from v. Unlike
+// containsProto, this looks at the dynamic values of interfaces, so that values which merely could
+// hold a message (e.g. any value with an interface field) are not copied needlessly.
+func (s *protoStripper) reachesProto(v reflect.Value) bool {
+	if !s.containsProto(v.Type()) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return false
+		}
+		key := pointerKey{v.Type(), v.Pointer()}
+		if s.seen[key] {
+			// Already checked, or being checked by the caller.
+			return false
+		}
+		s.seen[key] = true
+		return s.reachesProto(v.Elem())
+	case reflect.Interface:
+		return !v.IsNil() && s.reachesProto(v.Elem())
+	case reflect.Struct:
+		if reflect.PointerTo(v.Type()).Implements(protoMessageType) {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if s.reachesProto(v.Field(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if s.reachesProto(iter.Value()) {
+				return true
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if s.reachesProto(v.Index(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsProto reports whether values of type t may contain a protobuf message struct.
+func (s *protoStripper) containsProto(t reflect.Type) bool {
+	if s.visited[t] {
+		// Recursive type; if it contains a message, that will be found by the caller.
+		return false
+	}
+	s.visited[t] = true
+	defer delete(s.visited, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Array, reflect.Slice, reflect.Map:
+		return s.containsProto(t.Elem())
+	case reflect.Struct:
+		if reflect.PointerTo(t).Implements(protoMessageType) {
+			return true
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if s.containsProto(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
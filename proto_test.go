@@ -0,0 +1,103 @@
+package autogold
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func protoTestMessage(t *testing.T) *structpb.Struct {
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"name":  "autogold",
+		"count": 3,
+		"tags":  []interface{}{"b", "a"},
+		"nested": map[string]interface{}{
+			"enabled": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestExpectFile_proto(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		ExpectFile(t, protoTestMessage(t))
+	})
+	t.Run("json", func(t *testing.T) {
+		ExpectFile(t, protoTestMessage(t), Format(JSON))
+	})
+}
+
+func Test_stringify_proto(t *testing.T) {
+	msg := &timestamppb.Timestamp{Seconds: 1234, Nanos: 5}
+	// Populate the internal size cache and message state.
+	if _, err := proto.Marshal(msg); err != nil {
+		t.Fatal(err)
+	}
+	_ = msg.ProtoReflect().Descriptor()
+
+	want := "&timestamppb.Timestamp{Seconds: 1234, Nanos: 5}"
+	if got := stringify(msg, nil); got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	want = `[]*timestamppb.Timestamp{{
+	Seconds: 1234,
+	Nanos:   5,
+}}`
+	if got := stringify([]*timestamppb.Timestamp{msg}, nil); got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+type protoInner struct {
+	V interface{}
+}
+
+type protoOuter struct {
+	In   protoInner
+	Name string
+}
+
+func Test_stringify_protoAliasedPointers(t *testing.T) {
+	// &o and &o.In share an address, but have different types.
+	o := &protoOuter{In: protoInner{V: &timestamppb.Timestamp{Seconds: 1}}, Name: "o"}
+	v := struct {
+		A *protoOuter
+		B *protoInner
+	}{A: o, B: &o.In}
+	want := `struct {
+	A *autogold.protoOuter
+	B *autogold.protoInner
+}{
+	A: &autogold.protoOuter{
+		In: autogold.protoInner{
+			V: &timestamppb.Timestamp{Seconds: 1},
+		},
+		Name: "o",
+	},
+	B: &autogold.protoInner{V: &timestamppb.Timestamp{Seconds: 1}},
+}`
+	if got := stringify(v, nil); got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func Test_stripProtoInternals_noProto(t *testing.T) {
+	// Values which could, but do not, contain a message are not copied.
+	v := &protoInner{V: "value"}
+	if got := stripProtoInternals(v); got != v {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", v)
+	}
+}
+
+func Test_normalizeProtoText(t *testing.T) {
+	got := normalizeProtoText("name:  \"a  b\"\nnested  {\n  [ext.field]:  1\n  value: 2\n}")
+	want := "name: \"a  b\"\nnested {\n  [ext.field]: 1\n  value: 2\n}\n"
+	if got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
@@ -0,0 +1,178 @@
+package autogold
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hexops/autogold/v2/internal/naming"
+)
+
+const (
+	// renameThreshold is the minimum similarity of a created golden file and an unused golden file
+	// for them to be considered the golden file of a renamed test, as in git's rename detection.
+	renameThreshold = 0.75
+
+	// minSimilarLines is the number of lines both golden files must have for them to be considered
+	// the golden file of a renamed test if their contents are not identical, as small files are
+	// easily similar by chance.
+	minSimilarLines = 5
+)
+
+// goldenRename describes the golden file of a test which was renamed.
+type goldenRename struct {
+	from, to   string
+	similarity float64
+}
+
+func (r goldenRename) String() string {
+	return fmt.Sprintf("renamed golden file %s -> %s (%.0f%% similar)", r.from, r.to, r.similarity*100)
+}
+
+// renames pairs the golden files created during the run with the unused golden files (of the same
+// kind) whose contents are identical or most similar, which are likely the golden files of tests
+// that were renamed.
+func (j *cleanJournal) renames(unused []string) ([]goldenRename, error) {
+	j.mu.Lock()
+	created := make([]string, 0, len(j.created))
+	for path := range j.created {
+		created = append(created, path)
+	}
+	j.mu.Unlock()
+	if len(created) == 0 || len(unused) == 0 {
+		return nil, nil
+	}
+	sort.Strings(created)
+
+	contents := map[string][]byte{}
+	for _, path := range append(append([]string{}, created...), unused...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents[path] = data
+	}
+
+	var candidates []goldenRename
+	for _, to := range created {
+		for _, from := range unused {
+			if goldenExtension(from) != goldenExtension(to) {
+				continue
+			}
+			if sim := renameSimilarity(contents[from], contents[to]); sim >= renameThreshold {
+				candidates = append(candidates, goldenRename{from: from, to: to, similarity: sim})
+			}
+		}
+	}
+	// Pair the most similar files first, so that each golden file is renamed at most once.
+	sort.SliceStable(candidates, func(i, k int) bool {
+		return candidates[i].similarity > candidates[k].similarity
+	})
+	var (
+		renames []goldenRename
+		paired  = map[string]bool{}
+	)
+	for _, r := range candidates {
+		if paired[r.from] || paired[r.to] {
+			continue
+		}
+		paired[r.from], paired[r.to] = true, true
+		renames = append(renames, r)
+	}
+	sort.Slice(renames, func(i, k int) bool { return renames[i].to < renames[k].to })
+	return renames, nil
+}
+
+// rename moves the unused golden file onto the created golden file, keeping the created golden
+// file's contents, so that the move is apparent (e.g. file mode is preserved.)
+func (j *cleanJournal) rename(r goldenRename) error {
+	unlock, err := acquirePathLock(filepath.Dir(r.to))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if filepath.Dir(r.from) != filepath.Dir(r.to) {
+		unlockFrom, err := acquirePathLock(filepath.Dir(r.from))
+		if err != nil {
+			return err
+		}
+		defer unlockFrom()
+	}
+	data, err := os.ReadFile(r.to)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(r.from, r.to); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.to, data, 0o666); err != nil {
+		return err
+	}
+	return j.pruneEmptyDirs(r.from)
+}
+
+// withoutRenamed returns the unused golden files which were not renamed.
+func withoutRenamed(unused []string, renames []goldenRename) []string {
+	renamed := map[string]bool{}
+	for _, r := range renames {
+		renamed[r.from] = true
+	}
+	var remaining []string
+	for _, path := range unused {
+		if !renamed[path] {
+			remaining = append(remaining, path)
+		}
+	}
+	return remaining
+}
+
+// goldenExtension returns the golden file extension of path, e.g. ".golden.json".
+func goldenExtension(path string) string {
+	return naming.Extension(path)
+}
+
+// renameSimilarity returns the similarity of a and b as by similarity, or 0 if they are not identical
+// and either is too small for their similarity to be meaningful.
+func renameSimilarity(a, b []byte) float64 {
+	if bytes.Equal(a, b) {
+		return 1
+	}
+	if len(splitLinesAfter(a)) < minSimilarLines || len(splitLinesAfter(b)) < minSimilarLines {
+		return 0
+	}
+	return similarity(a, b)
+}
+
+// similarity returns the similarity of a and b between 0 and 1, based on the number of lines they
+// have in common.
+func similarity(a, b []byte) float64 {
+	if bytes.Equal(a, b) {
+		return 1
+	}
+	aLines, bLines := splitLinesAfter(a), splitLinesAfter(b)
+	counts := map[string]int{}
+	for _, line := range aLines {
+		counts[string(line)]++
+	}
+	common := 0
+	for _, line := range bLines {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			common++
+		}
+	}
+	if len(aLines)+len(bLines) == 0 {
+		return 1
+	}
+	return 2 * float64(common) / float64(len(aLines)+len(bLines))
+}
+
+func splitLinesAfter(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
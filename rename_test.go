@@ -0,0 +1,128 @@
+package autogold
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func Test_cleanJournal_renames(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestNew.golden":          "a\nb\nc\nd\ne\nf\ng\nh\n",
+		"TestNew/sub.golden.json": "{}\n",
+		"TestOld.golden":          "a\nb\nc\nd\ne\nf\ng\nx\n",
+		"TestOld.golden.json":     "a\nb\nc\nd\n",
+		"TestOther.golden":        "x\ny\nz\nd\n",
+		"TestOld/sub.golden.json": "{}\n",
+	})
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestNew", filepath.Join(dir, "TestNew.golden"))
+	j.create(filepath.Join(dir, "TestNew.golden"))
+	j.use("TestNew", filepath.Join(dir, "TestNew", "sub.golden.json"))
+	j.create(filepath.Join(dir, "TestNew", "sub.golden.json"))
+
+	unused, err := j.unused(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renames, err := j.renames(unused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []goldenRename{
+		{from: filepath.Join(dir, "TestOld.golden"), to: filepath.Join(dir, "TestNew.golden"), similarity: 0.875},
+		{from: filepath.Join(dir, "TestOld", "sub.golden.json"), to: filepath.Join(dir, "TestNew", "sub.golden.json"), similarity: 1},
+	}
+	if !reflect.DeepEqual(renames, want) {
+		t.Fatal("\ngot:\n", renames, "\nwant:\n", want)
+	}
+
+	for _, r := range renames {
+		if err := j.rename(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := map[string]string{
+		"TestNew.golden":          "a\nb\nc\nd\ne\nf\ng\nh\n",
+		"TestNew/sub.golden.json": "{}\n",
+		"TestOld.golden.json":     "a\nb\nc\nd\n",
+		"TestOther.golden":        "x\ny\nz\nd\n",
+	}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", wantFiles)
+	}
+
+	remaining := withoutRenamed(unused, renames)
+	wantRemaining := []string{filepath.Join(dir, "TestOld.golden.json"), filepath.Join(dir, "TestOther.golden")}
+	if !reflect.DeepEqual(remaining, wantRemaining) {
+		t.Fatal("\ngot:\n", remaining, "\nwant:\n", wantRemaining)
+	}
+}
+
+func Test_cleanJournal_renamesSmallFiles(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		"TestNew.golden": "header\nnew\n",
+		"TestOld.golden": "header\nold\n",
+	})
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestNew", filepath.Join(dir, "TestNew.golden"))
+	j.create(filepath.Join(dir, "TestNew.golden"))
+
+	unused, err := j.unused(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renames, err := j.renames(unused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 0 {
+		t.Fatal("expected small files sharing a line not to be renamed, got", renames)
+	}
+}
+
+func Test_cleanJournal_renamesRequireClean(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"TestNew.golden":     "same\n",
+		"TestSkipped.golden": "same\n",
+	}
+	testutil.WriteFiles(t, dir, files)
+	j := newCleanJournal()
+	j.useRoot(dir)
+	j.use("TestNew", filepath.Join(dir, "TestNew.golden"))
+	j.create(filepath.Join(dir, "TestNew.golden"))
+	setFlag(t, "update", "true")
+	setFlag(t, "clean", "false")
+
+	// The golden file of a skipped test is unused, but -update alone must not move it.
+	var out strings.Builder
+	if code := j.finish(&out, nil); code != 0 || out.String() != "" {
+		t.Fatal("\ngot:\n", out.String(), code)
+	}
+	got, err := readDirFiles(OSStore(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", files)
+	}
+
+	setFlag(t, "clean", "true")
+	out.Reset()
+	want := "autogold: renamed golden file " + filepath.Join(dir, "TestSkipped.golden") + " -> " + filepath.Join(dir, "TestNew.golden") + " (100% similar)\n"
+	if code := j.finish(&out, nil); code != 0 || out.String() != want {
+		t.Fatal("\ngot:\n", out.String(), code, "\nwant:\n", want, 0)
+	}
+}
@@ -0,0 +1,237 @@
+package autogold
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hexops/valast"
+)
+
+// SortSlices is an option that sorts every slice in the value before it is formatted, so that
+// values produced in an arbitrary order (map iteration, concurrent workers, etc.) always produce
+// the same output.
+//
+// Elements are ordered by their formatted Go syntax unless a SortSlicesBy option for the element
+// type is also given. Byte slices are left untouched, use SortSlicesAt to sort one explicitly. Only
+// slices reachable through exported struct fields are sorted.
+func SortSlices() Option {
+	return &option{sortSlices: true}
+}
+
+// SortSlicesAt is an option like SortSlices, but which only sorts the slices found at the given
+// paths. A path is a list of struct field names (or map keys) separated by dots, e.g. "Items" or
+// "Result.Items.Tags"; slice elements, pointers and interfaces do not add a path component. The
+// empty path refers to the value itself.
+func SortSlicesAt(paths ...string) Option {
+	return &option{sortSlicesAt: paths}
+}
+
+// SortSlicesBy is an option that sorts every []T slice in the value by the string returned from
+// key, regardless of where the slice is found.
+func SortSlicesBy[T any](key func(T) string) Option {
+	return &option{
+		sortSlicesBy: &sortKey{
+			elem: reflect.TypeOf((*T)(nil)).Elem(),
+			key: func(v reflect.Value) string {
+				// Elements may be nil if T is an interface type.
+				elem, _ := v.Interface().(T)
+				return key(elem)
+			},
+		},
+	}
+}
+
+type sortKey struct {
+	elem reflect.Type
+	key  func(v reflect.Value) string
+}
+
+// sortSlices returns a copy of v with slices sorted according to the sorting options provided. If
+// no sorting options were provided, v is returned as-is.
+//
+// The input value is never modified: any value containing a slice that is sorted is copied.
+func sortSlices(v interface{}, opts []Option) interface{} {
+	s := &slicesSorter{
+		paths:   map[string]bool{},
+		keys:    map[reflect.Type]func(reflect.Value) string{},
+		visited: map[reflect.Type]bool{},
+		copies:  map[pointerKey]reflect.Value{},
+	}
+	for _, opt := range opts {
+		opt := opt.(*option)
+		if opt.sortSlices {
+			s.all = true
+		}
+		for _, path := range opt.sortSlicesAt {
+			s.paths[path] = true
+		}
+		if opt.sortSlicesBy != nil {
+			s.keys[opt.sortSlicesBy.elem] = opt.sortSlicesBy.key
+		}
+	}
+	if v == nil || !s.all && len(s.paths) == 0 && len(s.keys) == 0 {
+		return v
+	}
+	return s.copy(reflect.ValueOf(v), "").Interface()
+}
+
+type slicesSorter struct {
+	all   bool
+	paths map[string]bool
+	keys  map[reflect.Type]func(reflect.Value) string
+
+	visited map[reflect.Type]bool        // types currently being checked by containsSlice
+	copies  map[pointerKey]reflect.Value // pointers already copied, to handle cyclic values
+}
+
+// pointerKey identifies a pointer which was copied. The type is part of the key, as pointers of
+// different types may share an address, e.g. a pointer to a struct and to its first field.
+type pointerKey struct {
+	typ  reflect.Type
+	addr uintptr
+}
+
+// copy returns a copy of v with slices at or below path sorted. Values which cannot contain a
+// slice are returned as-is.
+func (s *slicesSorter) copy(v reflect.Value, path string) reflect.Value {
+	if !s.containsSlice(v.Type()) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := pointerKey{v.Type(), v.Pointer()}
+		if c, ok := s.copies[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		s.copies[key] = c
+		c.Elem().Set(s.copy(v.Elem(), path))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(s.copy(v.Elem(), path))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if !c.Type().Field(i).IsExported() {
+				continue
+			}
+			field := c.Field(i)
+			field.Set(s.copy(field, joinPath(path, c.Type().Field(i).Name)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := settable(iter.Key())
+			value := settable(iter.Value())
+			c.SetMapIndex(key, s.copy(value, joinPath(path, fmt.Sprint(key.Interface()))))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(s.copy(settable(v.Index(i)), path))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(s.copy(settable(v.Index(i)), path))
+		}
+		s.sort(c, path)
+		return c
+	}
+	return v
+}
+
+// sort sorts the slice v in place, if the options indicate the slice at path should be sorted.
+func (s *slicesSorter) sort(v reflect.Value, path string) {
+	key, ok := s.keys[v.Type().Elem()]
+	if !ok {
+		isBytes := v.Type().Elem().Kind() == reflect.Uint8
+		if !s.paths[path] && (!s.all || isBytes) {
+			return
+		}
+		key = func(v reflect.Value) string {
+			return valast.StringWithOptions(v.Interface(), &valast.Options{})
+		}
+	}
+
+	// Compute keys up front, as formatting elements may be costly.
+	type element struct {
+		key   string
+		value reflect.Value
+	}
+	elements := make([]element, v.Len())
+	for i := range elements {
+		value := reflect.New(v.Type().Elem()).Elem()
+		value.Set(v.Index(i))
+		elements[i] = element{key: key(value), value: value}
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].key < elements[j].key
+	})
+	for i, e := range elements {
+		v.Index(i).Set(e.value)
+	}
+}
+
+// containsSlice reports whether values of type t may contain a slice.
+func (s *slicesSorter) containsSlice(t reflect.Type) bool {
+	if s.visited[t] {
+		// Recursive type; if it contains a slice, that will be found by the caller.
+		return false
+	}
+	s.visited[t] = true
+	defer delete(s.visited, t)
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Array:
+		return s.containsSlice(t.Elem())
+	case reflect.Map:
+		return s.containsSlice(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && s.containsSlice(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// settable returns v, or an addressable copy of v if it cannot be written to.
+func settable(v reflect.Value) reflect.Value {
+	if v.CanSet() {
+		return v
+	}
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
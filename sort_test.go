@@ -0,0 +1,216 @@
+package autogold
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sortItem struct {
+	Name string
+	Tags []string
+}
+
+type sortResult struct {
+	Items  []sortItem
+	Counts map[string][]int
+}
+
+func Test_sortSlices(t *testing.T) {
+	input := func() sortResult {
+		return sortResult{
+			Items: []sortItem{
+				{Name: "b", Tags: []string{"z", "y"}},
+				{Name: "a", Tags: []string{"x", "w"}},
+			},
+			Counts: map[string][]int{"k": {3, 1, 2}},
+		}
+	}
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "none",
+			want: `autogold.sortResult{
+	Items: []autogold.sortItem{
+		{
+			Name: "b",
+			Tags: []string{
+				"z",
+				"y",
+			},
+		},
+		{
+			Name: "a",
+			Tags: []string{
+				"x",
+				"w",
+			},
+		},
+	},
+	Counts: map[string][]int{"k": {
+		3,
+		1,
+		2,
+	}},
+}`,
+		},
+		{
+			name: "all",
+			opts: []Option{SortSlices()},
+			want: `autogold.sortResult{
+	Items: []autogold.sortItem{
+		{
+			Name: "a",
+			Tags: []string{
+				"w",
+				"x",
+			},
+		},
+		{
+			Name: "b",
+			Tags: []string{
+				"y",
+				"z",
+			},
+		},
+	},
+	Counts: map[string][]int{"k": {
+		1,
+		2,
+		3,
+	}},
+}`,
+		},
+		{
+			name: "path",
+			opts: []Option{SortSlicesAt("Items.Tags", "Counts.k")},
+			want: `autogold.sortResult{
+	Items: []autogold.sortItem{
+		{
+			Name: "b",
+			Tags: []string{
+				"y",
+				"z",
+			},
+		},
+		{
+			Name: "a",
+			Tags: []string{
+				"w",
+				"x",
+			},
+		},
+	},
+	Counts: map[string][]int{"k": {
+		1,
+		2,
+		3,
+	}},
+}`,
+		},
+		{
+			name: "key",
+			opts: []Option{SortSlicesBy(func(v sortItem) string { return v.Tags[1] })},
+			want: `autogold.sortResult{
+	Items: []autogold.sortItem{
+		{
+			Name: "a",
+			Tags: []string{
+				"x",
+				"w",
+			},
+		},
+		{
+			Name: "b",
+			Tags: []string{
+				"z",
+				"y",
+			},
+		},
+	},
+	Counts: map[string][]int{"k": {
+		3,
+		1,
+		2,
+	}},
+}`,
+		},
+	}
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			v := input()
+			got := stringify(v, tst.opts)
+			if got != tst.want {
+				t.Fatal("\ngot:\n", got, "\nwant:\n", tst.want)
+			}
+			if unmodified := stringify(input(), nil); stringify(v, nil) != unmodified {
+				t.Fatal("input value was modified")
+			}
+		})
+	}
+}
+
+func Test_sortSlices_bytes(t *testing.T) {
+	got := stringify([]byte("ba"), []Option{SortSlices()})
+	if strings.Contains(got, `"ab"`) {
+		t.Fatal("byte slices should not be sorted by SortSlices, got:\n", got)
+	}
+}
+
+type sortInner struct {
+	Tags []string
+}
+
+type sortOuter struct {
+	In   sortInner
+	Name string
+}
+
+func Test_sortSlices_aliasedPointers(t *testing.T) {
+	// &o and &o.In share an address, but have different types.
+	o := &sortOuter{In: sortInner{Tags: []string{"b", "a"}}, Name: "o"}
+	v := struct {
+		A *sortOuter
+		B *sortInner
+	}{A: o, B: &o.In}
+	got := stringify(v, []Option{SortSlices()})
+	want := `struct {
+	A *autogold.sortOuter
+	B *autogold.sortInner
+}{
+	A: &autogold.sortOuter{
+		In: autogold.sortInner{
+			Tags: []string{
+				"a",
+				"b",
+			},
+		},
+		Name: "o",
+	},
+	B: &autogold.sortInner{Tags: []string{
+		"a",
+		"b",
+	}},
+}`
+	if got != want {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
+
+func Test_sortSlicesBy_nilInterface(t *testing.T) {
+	a, b := errors.New("a"), errors.New("b")
+	got := sortSlices([]error{b, nil, a}, []Option{SortSlicesBy(func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	})})
+	want := []error{nil, a, b}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
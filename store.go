@@ -0,0 +1,281 @@
+package autogold
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store is a storage backend for golden files. Names are OS-specific file paths as determined by
+// the Dir, Name, PathFunc and PathTemplate options, e.g. "testdata/TestFoo.golden", which are
+// relative to the package directory unless an absolute Dir is given.
+//
+// The OS filesystem is used by default; MemStore and FSStore may be used instead via the Storage
+// option.
+type Store interface {
+	// ReadFile returns the contents of the named file. If the file does not exist, the returned
+	// error satisfies errors.Is(err, fs.ErrNotExist).
+	ReadFile(name string) ([]byte, error)
+
+	// WriteFile writes data to the named file, creating it and its parent directories as needed.
+	WriteFile(name string, data []byte) error
+
+	// Remove removes the named file. If the file does not exist, the returned error satisfies
+	// errors.Is(err, fs.ErrNotExist).
+	Remove(name string) error
+
+	// List returns the names of all files in the named directory and its subdirectories, in
+	// lexical order. If the directory does not exist, the returned error satisfies
+	// errors.Is(err, fs.ErrNotExist).
+	List(dir string) ([]string, error)
+
+	// Lock acquires an exclusive lock on the named directory, which may not exist yet, in order to
+	// prevent concurrent mutations to the golden files in it by parallel tests. The returned
+	// function releases the lock.
+	Lock(dir string) (unlock func() error, err error)
+}
+
+// Storage specifies the store golden files are read from and written to, instead of the OS
+// filesystem.
+//
+// Note that -clean only removes unused golden files from the OS filesystem.
+func Storage(store Store) Option {
+	return &option{store: store}
+}
+
+// goldenStore returns the store specified by the Storage option, or the OS filesystem, storing file
+// contents externally if the ExternalBlobs option is specified.
+func goldenStore(opts []Option) Store {
+	var (
+		store Store
+		blobs BlobStore
+	)
+	for _, opt := range opts {
+		opt := opt.(*option)
+		if opt.store != nil && store == nil {
+			store = opt.store
+		}
+		if opt.blobs != nil && blobs == nil {
+			blobs = opt.blobs
+		}
+	}
+	if store == nil {
+		store = osStore{}
+	}
+	if blobs != nil {
+		return externalStore{Store: store, blobs: blobs}
+	}
+	return store
+}
+
+// baseStore returns the store in which golden files (or their pointer files, if stored externally)
+// are stored.
+func baseStore(store Store) Store {
+	if external, ok := store.(externalStore); ok {
+		return external.Store
+	}
+	return store
+}
+
+// OSStore returns a store for golden files on the OS filesystem, which is the default. Directories
+// are locked using PID-based lockfiles in the OS temp dir, so that tests in different packages or
+// processes do not conflict.
+func OSStore() Store {
+	return osStore{}
+}
+
+type osStore struct{}
+
+func (osStore) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osStore) WriteFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(name, data, 0o666)
+}
+
+func (osStore) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osStore) List(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (osStore) Lock(dir string) (func() error, error) {
+	return acquirePathLock(dir)
+}
+
+// pruneEmptyDirs removes the parent directories of name which are empty, up to (but excluding)
+// root.
+func (osStore) pruneEmptyDirs(root, name string) error {
+	for parent := filepath.Dir(name); parent != root && strings.HasPrefix(parent, root); parent = filepath.Dir(parent) {
+		if entries, err := os.ReadDir(parent); err != nil || len(entries) > 0 {
+			break
+		}
+		if err := os.Remove(parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirPruner is implemented by stores which have a notion of directories that may be left empty
+// when files are removed.
+type dirPruner interface {
+	pruneEmptyDirs(root, name string) error
+}
+
+// MemStore is an in-memory store for golden files, useful for testing test helpers built on top of
+// autogold without touching the filesystem. The zero value is not ready for use, use NewMemStore.
+type MemStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	locks map[string]*sync.Mutex
+}
+
+// NewMemStore returns an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{files: map[string][]byte{}, locks: map[string]*sync.Mutex{}}
+}
+
+// ReadFile implements Store.
+func (s *MemStore) ReadFile(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte{}, data...), nil
+}
+
+// WriteFile implements Store.
+func (s *MemStore) WriteFile(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[filepath.Clean(name)] = append([]byte{}, data...)
+	return nil
+}
+
+// Remove implements Store.
+func (s *MemStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := s.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.files, name)
+	return nil
+}
+
+// List implements Store.
+func (s *MemStore) List(dir string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	var names []string
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Lock implements Store. Locks only apply within the MemStore.
+func (s *MemStore) Lock(dir string) (func() error, error) {
+	s.mu.Lock()
+	dir = filepath.Clean(dir)
+	lock, ok := s.locks[dir]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[dir] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() error {
+		lock.Unlock()
+		return nil
+	}, nil
+}
+
+// errReadOnly is returned when attempting to modify a read-only store.
+var errReadOnly = errors.New("golden file store is read-only")
+
+// FSStore returns a read-only store which reads golden files from fsys. This allows golden files to
+// be embedded into test binaries which run on machines without the source tree:
+//
+//	//go:embed testdata
+//	var testdata embed.FS
+//
+//	autogold.ExpectFile(t, got, autogold.Storage(autogold.FSStore(testdata)))
+//
+// Names are converted to slash-separated paths, so they must be relative (i.e. Dir must not be an
+// absolute path.) Using `-update` with a read-only store fails the test.
+func FSStore(fsys fs.FS) Store {
+	return fsStore{fsys: fsys}
+}
+
+type fsStore struct {
+	fsys fs.FS
+}
+
+func (s fsStore) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, filepath.ToSlash(filepath.Clean(name)))
+}
+
+func (s fsStore) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: errReadOnly}
+}
+
+func (s fsStore) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+func (s fsStore) List(dir string) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(s.fsys, filepath.ToSlash(filepath.Clean(dir)), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, filepath.FromSlash(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (s fsStore) Lock(dir string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,69 @@
+package autogold
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hexops/autogold/v2/internal/testutil"
+)
+
+func TestStorage_memStore(t *testing.T) {
+	store := NewMemStore()
+	if err := store.WriteFile(filepath.Join("testdata", "TestStorage_memStore.golden"), []byte("\"in memory\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	ExpectFile(t, "in memory", Storage(store))
+
+	dir := t.TempDir()
+	files := map[string]string{"b.txt": "b\n", "sub/a.txt": "a\n"}
+	testutil.WriteFiles(t, dir, files)
+	for name, data := range files {
+		if err := store.WriteFile(filepath.Join("golden", "files", filepath.FromSlash(name)), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ExpectDir(t, dir, Storage(store), PathFunc(func(string) string {
+		return filepath.Join("golden", "files")
+	}))
+
+	got, err := store.List("golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join("golden", "files", "b.txt"), filepath.Join("golden", "files", "sub", "a.txt")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+	if err := store.Remove(want[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReadFile(want[0]); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", fs.ErrNotExist)
+	}
+	if _, err := store.List("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", fs.ErrNotExist)
+	}
+}
+
+func TestStorage_fsStore(t *testing.T) {
+	store := FSStore(fstest.MapFS{
+		"testdata/TestStorage_fsStore.golden": {Data: []byte("\"embedded\"\n")},
+	})
+	ExpectFile(t, "embedded", Storage(store))
+
+	if err := store.WriteFile(filepath.Join("testdata", "x.golden"), nil); !errors.Is(err, errReadOnly) {
+		t.Fatal("\ngot:\n", err, "\nwant:\n", errReadOnly)
+	}
+	got, err := store.List("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join("testdata", "TestStorage_fsStore.golden")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("\ngot:\n", got, "\nwant:\n", want)
+	}
+}
@@ -0,0 +1,130 @@
+package autogold
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+// Recorder records a sequence of labeled values produced by a test, see Transcript.
+type Recorder struct {
+	t     *testing.T
+	opts  []Option
+	path  string
+	mu    sync.Mutex
+	steps []txtar.File
+}
+
+// Transcript returns a recorder which accumulates the values of each step of a stateful test
+// (e.g. the inputs and outputs of a REPL or an HTTP session), and when the test finishes checks if
+// the whole transcript is equal to the saved `testdata/<test name>.golden.txtar` file. If it is not,
+// the test is failed and the first step which diverged is reported.
+//
+// If the `go test -update` flag is specified, the transcript file will be updated/created
+// automatically and the test will not fail unless `-fail-on-update` is specified. Transcripts of
+// tests which fail or are skipped before finishing are not checked or updated.
+//
+// The options apply to formatting each step's value as well as the transcript file itself.
+func Transcript(t *testing.T, opts ...Option) *Recorder {
+	r := &Recorder{t: t, opts: opts, path: goldenPath(t, opts, archiveExtension)}
+	t.Cleanup(r.check)
+	return r
+}
+
+// Step records the value produced by a step of the test, under the given label. Labels do not need
+// to be unique.
+//
+// If the value is of type Raw, its contents will be directly used instead of the value being
+// formatted as a Go literal.
+func (r *Recorder) Step(label string, got interface{}) {
+	r.t.Helper()
+	opts := append(append([]Option{}, r.opts...), &option{allowRaw: true, trailingNewline: true})
+	gotString, err := formatFile(got, opts)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	step := txtar.File{Name: label, Data: []byte(gotString)}
+	if !isValidTxtarFile(step) {
+		r.t.Fatalf("autogold: step %q could not be stored in a txtar transcript, does it contain '-- name --' lines?", label)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+// isValidTxtarFile reports whether file is read back as a single file from a txtar archive, i.e.
+// its name and contents do not contain anything which would be parsed as the start of another file.
+func isValidTxtarFile(file txtar.File) bool {
+	files := txtar.Parse(txtar.Format(&txtar.Archive{Files: []txtar.File{file}})).Files
+	return len(files) == 1 && files[0].Name == file.Name
+}
+
+func (r *Recorder) check() {
+	t := r.t
+	if t.Failed() || t.Skipped() {
+		return
+	}
+	r.mu.Lock()
+	gotData := txtar.Format(&txtar.Archive{Files: r.steps})
+	r.mu.Unlock()
+
+	golden := openGoldenFile(t, r.opts, r.path)
+	defer golden.close()
+
+	// Compare the steps as read back from the transcript, so that any normalization performed by
+	// the txtar format (e.g. adding trailing newlines) does not produce a mismatch.
+	got := txtar.Parse(gotData).Files
+	var want []txtar.File
+	if wantData := golden.read(); wantData != nil {
+		want = txtar.Parse(wantData).Files
+	}
+	diff := transcriptDiff(want, got, r.opts)
+	if diff == "" {
+		return
+	}
+	if update() {
+		golden.write(gotData)
+	}
+	if *failOnUpdate || !update() {
+		t.Log(fmt.Errorf("transcript mismatch (-want +got):\n%s", colorDiff(diff)))
+		t.Fail()
+	}
+}
+
+// transcriptDiff describes the first step at which the got transcript diverges from the want
+// transcript, returning an empty string if they are equal.
+func transcriptDiff(want, got []txtar.File, opts []Option) string {
+	for i := 0; i < len(want) || i < len(got); i++ {
+		var wantStep, gotStep txtar.File
+		if i < len(want) {
+			wantStep = want[i]
+		}
+		if i < len(got) {
+			gotStep = got[i]
+		}
+		if wantStep.Name == gotStep.Name && string(wantStep.Data) == string(gotStep.Data) {
+			continue
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "diverged at step %d of %d (want %d steps)\n", i+1, len(got), len(want))
+		switch {
+		case i >= len(got):
+			fmt.Fprintf(&b, "missing step %q\n", wantStep.Name)
+		case i >= len(want):
+			fmt.Fprintf(&b, "unexpected step %q\n", gotStep.Name)
+		case wantStep.Name != gotStep.Name:
+			fmt.Fprintf(&b, "-step %q\n+step %q\n", wantStep.Name, gotStep.Name)
+		}
+		name := fmt.Sprintf("%d.%s", i+1, gotStep.Name)
+		if i >= len(got) {
+			name = fmt.Sprintf("%d.%s", i+1, wantStep.Name)
+		}
+		b.WriteString(fileDiff(name, string(gotStep.Data), string(wantStep.Data), opts))
+		return b.String()
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package autogold
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+func TestTranscript(t *testing.T) {
+	rec := Transcript(t)
+	stack := []int{}
+	for _, input := range []string{"push 1", "push 2", "pop"} {
+		rec.Step("input", Raw(input))
+		fields := strings.Fields(input)
+		switch fields[0] {
+		case "push":
+			n, _ := strconv.Atoi(fields[1])
+			stack = append(stack, n)
+		case "pop":
+			stack = stack[:len(stack)-1]
+		}
+		rec.Step("stack", stack)
+	}
+}
+
+func Test_transcriptDiff(t *testing.T) {
+	want := []txtar.File{
+		{Name: "input", Data: []byte("a\n")},
+		{Name: "output", Data: []byte("1\n")},
+		{Name: "input", Data: []byte("b\n")},
+	}
+	if diff := transcriptDiff(want, want, nil); diff != "" {
+		t.Fatal("expected no diff, got:\n", diff)
+	}
+
+	got := []txtar.File{
+		{Name: "input", Data: []byte("a\n")},
+		{Name: "output", Data: []byte("2\n")},
+	}
+	diff := transcriptDiff(want, got, nil)
+	wantDiff := `diverged at step 2 of 2 (want 3 steps)
+--- want/2.output
++++ got/2.output
+@@ -1 +1 @@
+-1
++2
+`
+	if diff != wantDiff {
+		t.Fatal("\ngot:\n", diff, "\nwant:\n", wantDiff)
+	}
+
+	diff = transcriptDiff(want, want[:2], nil)
+	wantDiff = `diverged at step 3 of 2 (want 3 steps)
+missing step "input"
+--- want/3.input
++++ got/3.input
+@@ -1,1 +0,0 @@
+-b
+`
+	if diff != wantDiff {
+		t.Fatal("\ngot:\n", diff, "\nwant:\n", wantDiff)
+	}
+}
+
+func Test_isValidTxtarFile(t *testing.T) {
+	for _, tst := range []struct {
+		step txtar.File
+		want bool
+	}{
+		{step: txtar.File{Name: "output", Data: []byte("a\nb\n")}, want: true},
+		{step: txtar.File{Name: "output", Data: []byte("a\n-- b --\nc\n")}, want: false},
+		{step: txtar.File{Name: "out\nput", Data: []byte("a\n")}, want: false},
+	} {
+		if got := isValidTxtarFile(tst.step); got != tst.want {
+			t.Fatal(tst.step.Name, "\ngot:\n", got, "\nwant:\n", tst.want)
+		}
+	}
+}